@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bgm-catch/internal/basic"
+	"bgm-catch/internal/scheduler"
 	"bgm-catch/internal/subject"
 	"bgm-catch/internal/user"
 	"flag"
@@ -10,9 +12,79 @@ import (
 )
 
 func main() {
+	// 守护进程模式: bgm-catch serve-scheduler [-config scheduler.json] [-data 目录]
+	if len(os.Args) > 1 && os.Args[1] == "serve-scheduler" {
+		serveFlags := flag.NewFlagSet("serve-scheduler", flag.ExitOnError)
+		configPath := serveFlags.String("config", "scheduler.json", "定时任务配置文件")
+		dataDir := serveFlags.String("data", "", dataFlagUsage)
+		serveFlags.Parse(os.Args[2:])
+		applyDataDir(*dataDir)
+		scheduler.Serve(*configPath)
+		return
+	}
+
+	// JSON文件与SQLite数据库互相转换: bgm-catch db [-data 目录] import|export
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		dbFlags := flag.NewFlagSet("db", flag.ExitOnError)
+		dataDir := dbFlags.String("data", "", dataFlagUsage)
+		dbFlags.Parse(os.Args[2:])
+		applyDataDir(*dataDir)
+		lockData(true, basic.LockUser, basic.LockSubject)
+		runDBCommand(dbFlags.Args())
+		return
+	}
+
+	// 用户目录迁移到分片布局并重建索引: bgm-catch migrate-users [-data 目录]
+	if len(os.Args) > 1 && os.Args[1] == "migrate-users" {
+		migrateFlags := flag.NewFlagSet("migrate-users", flag.ExitOnError)
+		dataDir := migrateFlags.String("data", "", dataFlagUsage)
+		migrateFlags.Parse(os.Args[2:])
+		applyDataDir(*dataDir)
+		lockData(true, basic.LockUser)
+		if err := user.MigrateUserLayout(); err != nil {
+			fmt.Println("迁移失败:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 转换已有数据的压缩方式: bgm-catch compress [-data 目录] [-outputs users,merged,subjects] gzip|zstd|none
+	if len(os.Args) > 1 && os.Args[1] == "compress" {
+		compressFlags := flag.NewFlagSet("compress", flag.ExitOnError)
+		dataDir := compressFlags.String("data", "", dataFlagUsage)
+		outputs := compressFlags.String("outputs", "users,merged,subjects", "要转换的输出，逗号分隔")
+		compressFlags.Parse(os.Args[2:])
+		applyDataDir(*dataDir)
+		lockData(true, basic.LockUser, basic.LockSubject)
+		runCompressCommand(compressFlags.Args(), *outputs)
+		return
+	}
+
+	// 打包备份数据目录: bgm-catch backup [-data 目录] [输出路径]
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		backupFlags := flag.NewFlagSet("backup", flag.ExitOnError)
+		dataDir := backupFlags.String("data", "", dataFlagUsage)
+		backupFlags.Parse(os.Args[2:])
+		applyDataDir(*dataDir)
+		lockData(false, basic.LockUser, basic.LockSubject)
+		path, err := basic.BackupData(backupFlags.Arg(0))
+		if err != nil {
+			fmt.Println("备份失败:", err)
+			os.Exit(1)
+		}
+		fmt.Println("备份完成:", path)
+		return
+	}
+
 	// 解析命令行参数
 	mode := flag.String("mode", "", "启动模式: subject 或 user")
+	research := flag.Bool("research", false, "研究模式: 允许抓取不在授权名单中的用户")
+	dataDir := flag.String("data", "", dataFlagUsage)
 	flag.Parse()
+	applyDataDir(*dataDir)
+	if *research {
+		user.ResearchMode = true
+	}
 
 	// 检查环境变量
 	if *mode == "" {
@@ -37,6 +109,24 @@ func main() {
 	}
 }
 
+const dataFlagUsage = "数据目录，默认为环境变量 DATA_DIR 或工作目录下的 data"
+
+func applyDataDir(dir string) {
+	if dir != "" {
+		basic.SetDataRoot(dir)
+	}
+}
+
+// 持有数据锁直到进程退出，exclusive 为 false 时只与写入数据的模块和定时任务互斥
+func lockData(exclusive bool, names ...string) {
+	for _, name := range names {
+		if _, err := basic.LockData(name, exclusive); err != nil {
+			fmt.Println("获取数据锁失败:", err)
+			os.Exit(1)
+		}
+	}
+}
+
 func startSubjectModule() {
 	fmt.Println("启动 subject 模块...")
 	subject.Main()
@@ -46,3 +136,48 @@ func startUserModule() {
 	fmt.Println("启动 user 模块...")
 	user.Main()
 }
+
+func runDBCommand(args []string) {
+	if len(args) != 1 || (args[0] != "import" && args[0] != "export") {
+		fmt.Println("用法: bgm-catch db import|export（数据库路径由 DB_PATH 指定，默认为数据目录下的 bgm.db）")
+		os.Exit(2)
+	}
+	var err error
+	if args[0] == "import" {
+		if err = subject.ImportDB(); err == nil {
+			err = user.ImportDB()
+		}
+	} else {
+		if err = subject.ExportDB(); err == nil {
+			err = user.ExportDB()
+		}
+	}
+	if err != nil {
+		fmt.Println("转换失败:", err)
+		os.Exit(1)
+	}
+}
+
+func runCompressCommand(args []string, outputs string) {
+	if len(args) != 1 {
+		fmt.Println("用法: bgm-catch compress [-outputs users,merged,subjects] gzip|zstd|none")
+		os.Exit(2)
+	}
+	method, err := basic.ParseCompression(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	for _, output := range strings.Split(outputs, ",") {
+		switch output = strings.TrimSpace(output); output {
+		case "subjects":
+			err = subject.CompressData(method)
+		default:
+			err = user.CompressData(output, method)
+		}
+		if err != nil {
+			fmt.Printf("转换 %s 失败: %v\n", output, err)
+			os.Exit(1)
+		}
+	}
+}
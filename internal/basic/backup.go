@@ -0,0 +1,85 @@
+package basic
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ------------------------- 数据备份 -------------------------
+// 把数据目录打包为 tar，按扩展名压缩；未指定输出路径时写入 backups 目录，压缩方式取 COMPRESS 中 backups 的设置。
+// 备份目录和锁文件不打包
+
+func backupsDir() string { return DataPath("backups") }
+
+// 打包数据目录，返回备份文件路径
+func BackupData(output string) (string, error) {
+	if output == "" {
+		output = OutputPath("backups", filepath.Join(backupsDir(), fmt.Sprintf("data_%s.tar", time.Now().Format("20060102_150405"))))
+	}
+	_, method := SplitCompressionExt(output)
+	tmpPath := output + ".tmp" // 写完后再改名，中断时不留下不完整的备份
+	writer, err := createWithMethod(tmpPath, method)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+
+	archive := tar.NewWriter(writer)
+	err = filepath.WalkDir(DataRoot(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && (path == backupsDir() || path == DataPath("locks")) {
+			return filepath.SkipDir
+		}
+		if path == tmpPath || !(entry.IsDir() || entry.Type().IsRegular()) {
+			return nil
+		}
+		rel, err := filepath.Rel(DataRoot(), path)
+		if err != nil || rel == "." {
+			return err
+		}
+		return addToArchive(archive, path, filepath.ToSlash(rel), entry)
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return output, os.Rename(tmpPath, output)
+}
+
+func addToArchive(archive *tar.Writer, path, name string, entry fs.DirEntry) error {
+	info, err := entry.Info()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if entry.IsDir() {
+		header.Name += "/"
+		return archive.WriteHeader(header)
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(archive, file)
+	return err
+}
@@ -0,0 +1,280 @@
+package basic
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ------------------------- 压缩存储 -------------------------
+// 压缩方式由扩展名决定：.gz 为 gzip，.zst 为 zstd，其余不压缩，读取时按扩展名自动解压。
+// 环境变量 COMPRESS 指定写入时各输出使用的压缩方式，可统一设置（COMPRESS=zstd），
+// 也可按输出分别设置（COMPRESS=users:zstd,merged:gzip,subjects:none），未列出的输出不压缩。
+// 输出名称：users（单个用户文件）、merged（合并后的用户数据）、subjects（条目、Staff和关系数据）、backups（数据备份）
+
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var compressionExts = map[string]string{
+	CompressGzip: ".gz",
+	CompressZstd: ".zst",
+}
+
+func ParseCompression(method string) (string, error) {
+	switch method = strings.ToLower(strings.TrimSpace(method)); method {
+	case "", CompressNone:
+		return CompressNone, nil
+	case CompressGzip, "gz":
+		return CompressGzip, nil
+	case CompressZstd, "zst":
+		return CompressZstd, nil
+	}
+	return "", fmt.Errorf("未知的压缩方式: %s（可选 gzip、zstd、none）", method)
+}
+
+// 指定输出在 COMPRESS 中配置的压缩方式，配置无效时提示并不压缩
+func OutputCompression(output string) string {
+	spec := strings.TrimSpace(os.Getenv("COMPRESS"))
+	if spec == "" {
+		return CompressNone
+	}
+	if !strings.Contains(spec, ":") {
+		return parseOrNone(spec)
+	}
+	for _, part := range strings.Split(spec, ",") {
+		name, method, _ := strings.Cut(part, ":")
+		if strings.TrimSpace(name) == output {
+			return parseOrNone(method)
+		}
+	}
+	return CompressNone
+}
+
+var (
+	invalidCompressMu   sync.Mutex
+	invalidCompressSeen = make(map[string]bool) // 每个无效值只提示一次
+)
+
+func parseOrNone(method string) string {
+	parsed, err := ParseCompression(method)
+	if err != nil {
+		invalidCompressMu.Lock()
+		defer invalidCompressMu.Unlock()
+		if !invalidCompressSeen[method] {
+			invalidCompressSeen[method] = true
+			log.Printf("环境变量 COMPRESS 中的压缩方式 %q 无效，不压缩: %v", method, err)
+		}
+		return CompressNone
+	}
+	return parsed
+}
+
+// 去掉压缩扩展名，返回原路径和压缩方式
+func SplitCompressionExt(path string) (string, string) {
+	for method, ext := range compressionExts {
+		if base, ok := strings.CutSuffix(path, ext); ok {
+			return base, method
+		}
+	}
+	return path, CompressNone
+}
+
+func WithCompressionExt(base, method string) string {
+	return base + compressionExts[method]
+}
+
+// 按输出的压缩配置生成写入路径
+func OutputPath(output, base string) string {
+	return WithCompressionExt(base, OutputCompression(output))
+}
+
+// 同一数据的所有可能路径，未压缩的排在最前
+func CompressionVariants(base string) []string {
+	return []string{base, base + compressionExts[CompressZstd], base + compressionExts[CompressGzip]}
+}
+
+// 返回已存在的路径，都不存在时返回未压缩的路径
+func FindCompressed(base string) string {
+	for _, path := range CompressionVariants(base) {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return base
+}
+
+// 删除同一数据除 keep 外的其他压缩版本，避免读取到旧文件
+func RemoveOtherVariants(base, keep string) error {
+	for _, path := range CompressionVariants(base) {
+		if path == keep {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+type compressedReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (r *compressedReader) Close() error {
+	var firstErr error
+	for _, closeFn := range r.closers {
+		if err := closeFn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.closers = nil // 重复关闭时不做处理
+	return firstErr
+}
+
+// 打开文件并按扩展名解压
+func OpenCompressed(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch _, method := SplitCompressionExt(path); method {
+	case CompressGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &compressedReader{Reader: gz, closers: []func() error{gz.Close, file.Close}}, nil
+	case CompressZstd:
+		zr, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &compressedReader{Reader: zr, closers: []func() error{func() error { zr.Close(); return nil }, file.Close}}, nil
+	}
+	return file, nil
+}
+
+type compressedWriter struct {
+	io.Writer
+	closers []func() error
+}
+
+// 依次关闭压缩流和文件，压缩流关闭时写出剩余数据
+func (w *compressedWriter) Close() error {
+	var firstErr error
+	for _, closeFn := range w.closers {
+		if err := closeFn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.closers = nil // 重复关闭时不做处理
+	return firstErr
+}
+
+// 创建文件并按扩展名压缩，必须调用 Close 才会写完
+func CreateCompressed(path string) (io.WriteCloser, error) {
+	_, method := SplitCompressionExt(path)
+	return createWithMethod(path, method)
+}
+
+func createWithMethod(path, method string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case CompressGzip:
+		gz := gzip.NewWriter(file)
+		return &compressedWriter{Writer: gz, closers: []func() error{gz.Close, file.Close}}, nil
+	case CompressZstd:
+		zw, err := zstd.NewWriter(file, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &compressedWriter{Writer: zw, closers: []func() error{zw.Close, file.Close}}, nil
+	}
+	return file, nil
+}
+
+func ReadCompressedFile(path string) ([]byte, error) {
+	reader, err := OpenCompressed(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func WriteCompressedFile(path string, data []byte) error {
+	writer, err := CreateCompressed(path)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// 把文件转换为指定压缩方式，返回新路径；已是该方式时不做处理
+func ConvertFileCompression(path, method string) (string, error) {
+	base, current := SplitCompressionExt(path)
+	if current == method {
+		return path, nil
+	}
+	target := WithCompressionExt(base, method)
+
+	reader, err := OpenCompressed(path)
+	if err != nil {
+		return path, err
+	}
+	defer reader.Close()
+	writer, err := createWithMethod(target+".tmp", method)
+	if err != nil {
+		return path, err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		os.Remove(target + ".tmp")
+		return path, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := writer.Close(); err != nil {
+		os.Remove(target + ".tmp")
+		return path, err
+	}
+	if err := os.Rename(target+".tmp", target); err != nil {
+		return path, err
+	}
+	return target, os.Remove(path)
+}
+
+// 转换某个输出文件（任意压缩版本）为指定压缩方式并删除其他版本，文件不存在时返回空路径
+func ConvertOutputFile(base, method string) (string, error) {
+	path := FindCompressed(base)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+	target, err := ConvertFileCompression(path, method)
+	if err != nil {
+		return "", err
+	}
+	return target, RemoveOtherVariants(base, target)
+}
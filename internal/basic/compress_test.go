@@ -0,0 +1,93 @@
+package basic
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedFileRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"user_id":1,"wish":[]}`+"\n", 1000))
+	for _, method := range []string{CompressNone, CompressGzip, CompressZstd} {
+		path := WithCompressionExt(filepath.Join(t.TempDir(), "user.json"), method)
+		if err := WriteCompressedFile(path, data); err != nil {
+			t.Fatalf("WriteCompressedFile(%s) error = %v", method, err)
+		}
+		got, err := ReadCompressedFile(path)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: 读出的内容与写入的不一致: %v", method, err)
+		}
+	}
+}
+
+func TestOutputCompression(t *testing.T) {
+	tests := []struct {
+		env, output, want string
+	}{
+		{"", "users", CompressNone},
+		{"GZ", "users", CompressGzip},
+		{"users:zstd,merged:gzip", "merged", CompressGzip},
+		{"users:zstd,merged:gzip", "subjects", CompressNone},
+		{"users:bogus", "users", CompressNone}, // 无效值提示后不压缩
+	}
+	for _, tt := range tests {
+		t.Setenv("COMPRESS", tt.env)
+		if got := OutputCompression(tt.output); got != tt.want {
+			t.Errorf("COMPRESS=%q OutputCompression(%s) = %s, want %s", tt.env, tt.output, got, tt.want)
+		}
+	}
+}
+
+// 备份按 COMPRESS 压缩，不包含备份目录和锁文件
+func TestBackupData(t *testing.T) {
+	previous := DataRoot()
+	t.Setenv("DATA_DIR", previous)
+	SetDataRoot(t.TempDir())
+	defer SetDataRoot(previous)
+	t.Setenv("COMPRESS", "backups:zstd")
+
+	for _, name := range []string{"anime.json", "users/1.json", "locks/user.lock"} {
+		path := DataPath(name)
+		os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := BackupData(""); err != nil { // 第二次备份不应包含第一次的备份
+		t.Fatal(err)
+	}
+	path, err := BackupData("")
+	if err != nil {
+		t.Fatalf("BackupData() error = %v", err)
+	}
+	if !strings.HasSuffix(path, ".tar.zst") {
+		t.Errorf("BackupData() = %s, want .tar.zst", path)
+	}
+
+	input, err := OpenCompressed(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	var files []string
+	archive := tar.NewReader(input)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	if got := strings.Join(files, ","); got != "anime.json,users/1.json" {
+		t.Errorf("备份中的文件 = %s, want anime.json,users/1.json", got)
+	}
+}
@@ -0,0 +1,33 @@
+package basic
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ------------------------- 数据目录 -------------------------
+// 所有数据文件都位于数据目录下，默认为工作目录下的 data，可通过环境变量 DATA_DIR 或 -data 参数指定
+
+var dataRoot = envOr("DATA_DIR", "data")
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// 设置数据目录，同时写入环境变量，使定时任务启动的子进程使用同一目录
+func SetDataRoot(dir string) {
+	dataRoot = dir
+	os.Setenv("DATA_DIR", dir)
+}
+
+func DataRoot() string {
+	return dataRoot
+}
+
+// 数据目录下的路径
+func DataPath(elem ...string) string {
+	return filepath.Join(append([]string{dataRoot}, elem...)...)
+}
@@ -0,0 +1,203 @@
+package basic
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// ------------------------- SQLite存储 -------------------------
+// 设置环境变量 STORAGE=sqlite 时，条目、Staff、关系、用户和映射表改为读写嵌入式数据库，
+// 数据库路径由 DB_PATH 指定（默认为数据目录下的 bgm.db），JSON文件与数据库之间可通过 db import/export 互相转换
+
+var (
+	db     *sql.DB
+	dbErr  error
+	dbOnce sync.Once
+)
+
+func UseSQLite() bool {
+	return strings.EqualFold(os.Getenv("STORAGE"), "sqlite")
+}
+
+func DBPath() string {
+	if path := os.Getenv("DB_PATH"); path != "" {
+		return path
+	}
+	return DataPath("bgm.db")
+}
+
+// 打开数据库并建表，整个进程共用一个连接
+func OpenDB() (*sql.DB, error) {
+	dbOnce.Do(func() {
+		path := DBPath()
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			dbErr = fmt.Errorf("创建数据库目录失败: %v", err)
+			return
+		}
+		db, dbErr = sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=foreign_keys(1)")
+		if dbErr != nil {
+			return
+		}
+		// SQLite 同一时间只允许一个写入者，使用单连接避免锁冲突
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(dbSchema); err != nil {
+			dbErr = fmt.Errorf("初始化数据库失败: %v", err)
+		}
+	})
+	return db, dbErr
+}
+
+// 在事务中执行 fn，出错时回滚
+func WithTx(fn func(tx *sql.Tx) error) error {
+	conn, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS subjects (
+	id             INTEGER PRIMARY KEY,
+	project_id     INTEGER NOT NULL,
+	type           INTEGER NOT NULL,
+	name           TEXT NOT NULL,
+	name_cn        TEXT NOT NULL,
+	date           TEXT NOT NULL,
+	platform       TEXT NOT NULL,
+	summary        TEXT NOT NULL,
+	eps            INTEGER NOT NULL,
+	total_episodes INTEGER NOT NULL,
+	volumes        INTEGER NOT NULL,
+	locked         INTEGER NOT NULL,
+	nsfw           INTEGER NOT NULL,
+	series         INTEGER NOT NULL,
+	rating_rank    INTEGER NOT NULL,
+	rating_score   REAL NOT NULL,
+	rating_total   INTEGER NOT NULL,
+	rating_count   TEXT NOT NULL,
+	collect_wish    INTEGER NOT NULL,
+	collect_collect INTEGER NOT NULL,
+	collect_doing   INTEGER NOT NULL,
+	collect_on_hold INTEGER NOT NULL,
+	collect_dropped INTEGER NOT NULL,
+	images         TEXT NOT NULL,
+	meta_tags      TEXT NOT NULL,
+	status         TEXT NOT NULL DEFAULT '',
+	merged_into    INTEGER NOT NULL DEFAULT 0,
+	on_air         INTEGER NOT NULL DEFAULT 0,
+	air_weekday    INTEGER NOT NULL DEFAULT 0,
+	fetched_at     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_subjects_project ON subjects(project_id);
+
+CREATE TABLE IF NOT EXISTS subject_tags (
+	subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	name       TEXT NOT NULL,
+	count      INTEGER NOT NULL,
+	total_cont INTEGER NOT NULL,
+	PRIMARY KEY (subject_id, position)
+);
+CREATE INDEX IF NOT EXISTS idx_subject_tags_name ON subject_tags(name);
+
+CREATE TABLE IF NOT EXISTS subject_infobox (
+	subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	key        TEXT NOT NULL,
+	value      TEXT NOT NULL,
+	PRIMARY KEY (subject_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS persons (
+	id     INTEGER PRIMARY KEY,
+	name   TEXT NOT NULL,
+	type   INTEGER NOT NULL,
+	career TEXT NOT NULL,
+	images TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subject_staff_sets (
+	subject_id INTEGER PRIMARY KEY,
+	project_id INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subject_persons (
+	subject_id INTEGER NOT NULL REFERENCES subject_staff_sets(subject_id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	person_id  INTEGER NOT NULL,
+	relation   TEXT NOT NULL,
+	eps        TEXT NOT NULL,
+	PRIMARY KEY (subject_id, position)
+);
+CREATE INDEX IF NOT EXISTS idx_subject_persons_person ON subject_persons(person_id);
+
+CREATE TABLE IF NOT EXISTS subject_relation_sets (
+	subject_id INTEGER PRIMARY KEY,
+	project_id INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subject_relations (
+	subject_id INTEGER NOT NULL REFERENCES subject_relation_sets(subject_id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	related_id INTEGER NOT NULL,
+	relation   TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	name_cn    TEXT NOT NULL,
+	type       INTEGER NOT NULL,
+	images     TEXT NOT NULL,
+	PRIMARY KEY (subject_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	user_id        INTEGER PRIMARY KEY,
+	project_id     INTEGER NOT NULL,
+	name           TEXT NOT NULL,
+	catch_time     TEXT NOT NULL,
+	full_sync_time TEXT NOT NULL DEFAULT '',
+	fetch_status   TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS user_collections (
+	user_id    INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	subject_id INTEGER NOT NULL,
+	project_id INTEGER NOT NULL,
+	type       INTEGER NOT NULL,
+	rate       INTEGER NOT NULL,
+	comment    TEXT NOT NULL,
+	tags       TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	ep_status  INTEGER NOT NULL,
+	vol_status INTEGER NOT NULL,
+	private    INTEGER NOT NULL,
+	subject    TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (user_id, position)
+);
+CREATE INDEX IF NOT EXISTS idx_user_collections_subject ON user_collections(subject_id);
+
+CREATE TABLE IF NOT EXISTS anime_remap (
+	project_id  INTEGER NOT NULL,
+	original_id INTEGER PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS user_remap (
+	project_id INTEGER NOT NULL,
+	user_id    INTEGER PRIMARY KEY,
+	user_name  TEXT NOT NULL
+);
+`
@@ -0,0 +1,440 @@
+package basic
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------------- ID表达式 -------------------------
+// 以逗号或换行分隔的若干项，按顺序惰性展开并去重：
+//   12              单个ID
+//   1-1000          范围（起始大于结束时倒序）
+//   1-1000/10       带步长的范围
+//   !500-600        排除（可用于任意一项）
+//   @ids.txt        从文件读取表达式，@- 表示从标准输入读取
+//   @users.csv#user_id  读取CSV的某一列（列名或从1开始的列号）
+//   users-empty     数据集选择器，可带参数，例如 subjects-stale>30d、index:12345
+// 选择器按作用域注册，条目模块只能使用条目选择器，用户模块只能使用用户选择器
+
+// 选择器返回的ID列表，op为参数前的运算符（: > < =），没有参数时为空
+type SelectorFunc func(op, arg string) ([]int, error)
+
+// 选择器作用域
+const (
+	ScopeSubject = "subject"
+	ScopeUser    = "user"
+)
+
+var (
+	selectors   = make(map[string]map[string]SelectorFunc) // 作用域 -> 名称 -> 选择器
+	selectorsMu sync.RWMutex
+	// @- 读取的输入源，交互模式下应设置为与提示共用的reader
+	stdinReader io.Reader = os.Stdin
+)
+
+// 在指定作用域注册数据集选择器，名称统一为小写
+func RegisterSelector(scope, name string, fn SelectorFunc) {
+	selectorsMu.Lock()
+	defer selectorsMu.Unlock()
+	if selectors[scope] == nil {
+		selectors[scope] = make(map[string]SelectorFunc)
+	}
+	selectors[scope][strings.ToLower(name)] = fn
+}
+
+// 查找选择器，不在当前作用域时返回错误并说明所属的作用域
+func lookupSelector(scope, name string) (SelectorFunc, error) {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+	name = strings.ToLower(name)
+	if fn, exists := selectors[scope][name]; exists {
+		return fn, nil
+	}
+	for other, registry := range selectors {
+		if _, exists := registry[name]; exists {
+			return nil, fmt.Errorf("选择器 %s 属于 %s 数据，不能在 %s 模块中使用", name, other, scope)
+		}
+	}
+	return nil, fmt.Errorf("未知的选择器: %s", name)
+}
+
+// 设置 @- 的输入源
+func SetStdin(r io.Reader) {
+	stdinReader = r
+}
+
+var (
+	rangePattern    = regexp.MustCompile(`^(\d+)\s*-\s*(\d+)(?:\s*/\s*(\d+))?$`)
+	selectorPattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_-]*?)\s*(?:([:><=])\s*(.*))?$`)
+)
+
+type idTerm interface {
+	all() iter.Seq[int]
+	contains(id int) bool
+}
+
+// 范围项，不展开为切片
+type rangeTerm struct {
+	start, end, step int
+}
+
+func (t rangeTerm) all() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		if t.start <= t.end {
+			for id := t.start; id <= t.end; id += t.step {
+				if !yield(id) {
+					return
+				}
+			}
+			return
+		}
+		for id := t.start; id >= t.end; id -= t.step {
+			if !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+func (t rangeTerm) contains(id int) bool {
+	low, high := t.start, t.end
+	if low > high {
+		low, high = high, low
+	}
+	if id < low || id > high {
+		return false
+	}
+	return (id-t.start)%t.step == 0
+}
+
+// 列表项（单个ID、文件、选择器的结果），已去重
+type listTerm struct {
+	ids []int
+	set map[int]struct{}
+}
+
+func newListTerm(ids []int) *listTerm {
+	t := &listTerm{set: make(map[int]struct{}, len(ids))}
+	for _, id := range ids {
+		if _, exists := t.set[id]; !exists {
+			t.set[id] = struct{}{}
+			t.ids = append(t.ids, id)
+		}
+	}
+	return t
+}
+
+func (t *listTerm) all() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for _, id := range t.ids {
+			if !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+func (t *listTerm) contains(id int) bool {
+	_, exists := t.set[id]
+	return exists
+}
+
+// 解析后的ID表达式
+type IDExpr struct {
+	scope    string // 可使用的选择器作用域
+	includes []idTerm
+	excludes []idTerm
+}
+
+// 解析ID表达式，scope 为可使用的选择器作用域（ScopeSubject 或 ScopeUser）
+func ParseIDExpr(input, scope string) (*IDExpr, error) {
+	expr := &IDExpr{scope: scope}
+	if err := expr.parse(input, 0); err != nil {
+		return nil, err
+	}
+	if len(expr.includes) == 0 {
+		return nil, fmt.Errorf("ID表达式为空")
+	}
+	return expr, nil
+}
+
+func (e *IDExpr) parse(input string, depth int) error {
+	if depth > 5 {
+		return fmt.Errorf("文件引用层级过深")
+	}
+	for _, part := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		part = strings.TrimSpace(part)
+		if part == "" || strings.HasPrefix(part, "#") {
+			continue
+		}
+
+		exclude := strings.HasPrefix(part, "!")
+		if exclude {
+			part = strings.TrimSpace(part[1:])
+		}
+
+		var terms []idTerm
+		if strings.HasPrefix(part, "@") {
+			sub := &IDExpr{scope: e.scope}
+			if err := sub.parseFile(part[1:], depth); err != nil {
+				return err
+			}
+			// 文件内的排除项作用于整个表达式
+			terms = sub.includes
+			e.excludes = append(e.excludes, sub.excludes...)
+		} else {
+			term, err := e.parseTerm(part)
+			if err != nil {
+				return err
+			}
+			terms = []idTerm{term}
+		}
+
+		if exclude {
+			e.excludes = append(e.excludes, terms...)
+		} else {
+			e.includes = append(e.includes, terms...)
+		}
+	}
+	return nil
+}
+
+func (e *IDExpr) parseTerm(part string) (idTerm, error) {
+	if id, err := strconv.Atoi(part); err == nil {
+		return newListTerm([]int{id}), nil
+	}
+
+	if m := rangePattern.FindStringSubmatch(part); m != nil {
+		start, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("无效起始ID: %s", m[1])
+		}
+		end, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("无效结束ID: %s", m[2])
+		}
+		step := 1
+		if m[3] != "" {
+			step, err = strconv.Atoi(m[3])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("无效步长: %s", m[3])
+			}
+		}
+		return rangeTerm{start: start, end: end, step: step}, nil
+	}
+
+	if m := selectorPattern.FindStringSubmatch(part); m != nil {
+		fn, err := lookupSelector(e.scope, m[1])
+		if err != nil {
+			return nil, err
+		}
+		ids, err := fn(m[2], strings.TrimSpace(m[3]))
+		if err != nil {
+			return nil, fmt.Errorf("选择器 %s 执行失败: %v", part, err)
+		}
+		return newListTerm(ids), nil
+	}
+
+	return nil, fmt.Errorf("无效ID: %s", part)
+}
+
+// 读取 @文件 或 @文件#列
+func (e *IDExpr) parseFile(ref string, depth int) error {
+	path, column, hasColumn := strings.Cut(ref, "#")
+	path = strings.TrimSpace(path)
+
+	var r io.Reader
+	if path == "-" {
+		r = readStdinBlock()
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("读取ID文件失败: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if hasColumn || strings.HasSuffix(strings.ToLower(path), ".csv") {
+		ids, err := readCSVColumn(r, strings.TrimSpace(column))
+		if err != nil {
+			return fmt.Errorf("读取CSV %s 失败: %v", path, err)
+		}
+		e.includes = append(e.includes, newListTerm(ids))
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return e.parse(string(data), depth+1)
+}
+
+// 从交互输入中读取到空行或EOF为止
+func readStdinBlock() io.Reader {
+	var sb strings.Builder
+	scanner := bufio.NewScanner(stdinReader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return strings.NewReader(sb.String())
+}
+
+// 读取CSV中的一列ID；column为空时取第一列，为列名时需有标题行，为数字时按从1开始的列号
+func readCSVColumn(r io.Reader, column string) ([]int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	index := 0
+	start := 0
+	if n, err := strconv.Atoi(column); err == nil {
+		index = n - 1
+	} else if column != "" {
+		index = -1
+		for i, name := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("没有名为 %s 的列", column)
+		}
+		start = 1
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("无效列号: %s", column)
+	}
+
+	var ids []int
+	for i, record := range records[start:] {
+		if index >= len(record) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(record[index]))
+		if err != nil {
+			if i == 0 && start == 0 {
+				continue // 没有指定列名时跳过可能存在的标题行
+			}
+			return nil, fmt.Errorf("第 %d 行无效ID: %s", start+i+1, record[index])
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// 按顺序惰性输出ID，已排除和重复的ID会被跳过
+func (e *IDExpr) All() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i, term := range e.includes {
+			for id := range term.all() {
+				if e.excluded(id) || e.seenBefore(i, id) {
+					continue
+				}
+				if !yield(id) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *IDExpr) excluded(id int) bool {
+	for _, term := range e.excludes {
+		if term.contains(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// 前面的项已经输出过该ID
+func (e *IDExpr) seenBefore(index, id int) bool {
+	for _, term := range e.includes[:index] {
+		if term.contains(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// 表达式包含的ID数量（逐个计数，不分配切片）
+func (e *IDExpr) Count() int {
+	count := 0
+	for range e.All() {
+		count++
+	}
+	return count
+}
+
+// 展开为切片，仅用于数量可控的场景；大范围应使用 All 或 Chunk 分批处理
+func (e *IDExpr) Collect() []int {
+	var ids []int
+	for id := range e.All() {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// 将ID序列按固定大小分批
+func Chunk(seq iter.Seq[int], size int) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		batch := make([]int, 0, size)
+		for id := range seq {
+			batch = append(batch, id)
+			if len(batch) == size {
+				if !yield(batch) {
+					return
+				}
+				batch = make([]int, 0, size)
+			}
+		}
+		if len(batch) > 0 {
+			yield(batch)
+		}
+	}
+}
+
+// 解析选择器中的时长参数，支持 30d、2w、12h 以及 time.ParseDuration 的格式
+func ParseAge(arg string) (time.Duration, error) {
+	arg = strings.TrimSpace(strings.ToLower(arg))
+	if arg == "" {
+		return 0, fmt.Errorf("缺少时长参数")
+	}
+	unit := arg[len(arg)-1]
+	if unit == 'd' || unit == 'w' {
+		n, err := strconv.Atoi(arg[:len(arg)-1])
+		if err != nil {
+			return 0, fmt.Errorf("无效时长: %s", arg)
+		}
+		days := n
+		if unit == 'w' {
+			days = n * 7
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(arg)
+}
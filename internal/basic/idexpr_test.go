@@ -0,0 +1,67 @@
+package basic
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIDExpr(t *testing.T) {
+	idsFile := filepath.Join(t.TempDir(), "ids.txt")
+	if err := os.WriteFile(idsFile, []byte("# 注释\n7\n8-9\n!8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	RegisterSelector("test", "test-even", func(op, arg string) ([]int, error) { return []int{2, 4, 6}, nil })
+	RegisterSelector("other", "other-only", func(op, arg string) ([]int, error) { return []int{1}, nil })
+
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr string
+	}{
+		{input: "3,1-2", want: []int{3, 1, 2}},
+		{input: "1-10/3,!4", want: []int{1, 7, 10}},
+		{input: "1-3,2,3-4", want: []int{1, 2, 3, 4}},
+		{input: "@" + idsFile + ",8", want: []int{7, 9}},
+		{input: "test-even,!4", want: []int{2, 6}},
+		{input: "other-only", wantErr: "不能在 test 模块中使用"},
+		{input: "1-10/0", wantErr: "无效步长"},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseIDExpr(tt.input, "test")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseIDExpr(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseIDExpr(%q) error = %v", tt.input, err)
+			continue
+		}
+		if got := expr.Collect(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseIDExpr(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// 大范围只在迭代时展开，可以提前停止
+func TestIDExprLazy(t *testing.T) {
+	expr, err := ParseIDExpr("1-1000000000,!2", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for id := range expr.All() {
+		got = append(got, id)
+		if len(got) == 3 {
+			break
+		}
+	}
+	if want := []int{1, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+}
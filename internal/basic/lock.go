@@ -0,0 +1,86 @@
+package basic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ------------------------- 进程间数据锁 -------------------------
+// 锁文件位于数据目录下的 locks 中，使用操作系统的咨询锁（flock），进程退出时自动释放，不会残留。
+// 条目模块独占 subject 锁，用户模块独占 user 锁，读取条目映射表时持有 subject 共享锁，
+// 调度守护进程独占 scheduler 锁。手动运行、定时任务的子进程和其他守护进程之间因此互斥。
+// 同时持有多个锁时按 user、subject 的顺序获取，避免互相等待
+
+const (
+	LockSubject   = "subject"
+	LockUser      = "user"
+	LockScheduler = "scheduler"
+)
+
+var ErrLocked = errors.New("数据锁已被其他进程占用")
+
+type DataLock struct {
+	name string
+	file *os.File
+}
+
+func lockFilePath(name string) string {
+	return DataPath("locks", name+".lock")
+}
+
+func openLockFile(name string) (*os.File, error) {
+	path := lockFilePath(name)
+	if err := os.MkdirAll(DataPath("locks"), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("创建锁目录失败: %v", err)
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+}
+
+// 获取数据锁，exclusive 为 false 时为共享锁；被占用时提示并等待释放
+func LockData(name string, exclusive bool) (*DataLock, error) {
+	lock, err := TryLockData(name, exclusive)
+	if !errors.Is(err, ErrLocked) {
+		return lock, err
+	}
+	fmt.Printf("数据锁 %s 被其他进程占用，等待释放...\n", name)
+
+	file, err := openLockFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := flockFile(file, exclusive, true); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("获取数据锁 %s 失败: %v", name, err)
+	}
+	return &DataLock{name: name, file: file}, nil
+}
+
+// 获取数据锁，被占用时立即返回 ErrLocked
+func TryLockData(name string, exclusive bool) (*DataLock, error) {
+	file, err := openLockFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := flockFile(file, exclusive, false); err != nil {
+		file.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%s: %w", name, ErrLocked)
+		}
+		return nil, fmt.Errorf("获取数据锁 %s 失败: %v", name, err)
+	}
+	return &DataLock{name: name, file: file}, nil
+}
+
+// 释放锁，重复调用时不做处理
+func (l *DataLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := funlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package basic
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+var warnNoFlock sync.Once
+
+// 不支持 flock 的平台上不加锁，只在首次使用时提示
+func flockFile(file *os.File, exclusive, wait bool) error {
+	warnNoFlock.Do(func() {
+		log.Printf("当前平台不支持文件锁，请避免同时运行多个写入同一数据的进程")
+	})
+	return nil
+}
+
+func funlockFile(file *os.File) error {
+	return nil
+}
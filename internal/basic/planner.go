@@ -0,0 +1,92 @@
+package basic
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------- 刷新计划 -------------------------
+
+// 待刷新的对象（用户或条目）
+type RefreshItem struct {
+	ID          int
+	LastFetched time.Time // 零值表示从未获取
+	Active      bool      // 活跃对象的过期程度加倍计算，优先刷新
+	Cost        int       // 预计请求数，至少为1
+}
+
+// 单次运行的预算，零值表示不限制
+type RefreshBudget struct {
+	MaxRequests int
+	MaxDuration time.Duration
+}
+
+// 从开始时间计算截止时间，不限时长时返回零值
+func (b RefreshBudget) Deadline(start time.Time) time.Time {
+	if b.MaxDuration <= 0 {
+		return time.Time{}
+	}
+	return start.Add(b.MaxDuration)
+}
+
+// 解析预算输入，例如 "500"（请求数）、"30m"（时长）或 "500,30m"，留空表示不限
+func ParseRefreshBudget(input string) (RefreshBudget, error) {
+	var budget RefreshBudget
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(part); err == nil {
+			budget.MaxRequests = n
+			continue
+		}
+		d, err := ParseAge(part)
+		if err != nil {
+			return budget, fmt.Errorf("无效预算: %s", part)
+		}
+		budget.MaxDuration = d
+	}
+	return budget, nil
+}
+
+// 按过期程度排序（从未获取的最先），在请求预算内依次选取，放不下的条目跳过，
+// 剩余预算继续留给后面成本更低的条目，返回计划刷新的ID和预计请求数
+func PlanRefresh(items []RefreshItem, budget RefreshBudget, now time.Time) ([]int, int) {
+	staleness := func(item RefreshItem) time.Duration {
+		if item.LastFetched.IsZero() {
+			return time.Duration(1<<63 - 1)
+		}
+		age := now.Sub(item.LastFetched)
+		if item.Active {
+			age *= 2
+		}
+		return age
+	}
+
+	sorted := make([]RefreshItem, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return staleness(sorted[i]) > staleness(sorted[j])
+	})
+
+	var (
+		ids      []int
+		requests int
+	)
+	for _, item := range sorted {
+		cost := item.Cost
+		if cost < 1 {
+			cost = 1
+		}
+		if budget.MaxRequests > 0 && requests+cost > budget.MaxRequests {
+			continue
+		}
+		requests += cost
+		ids = append(ids, item.ID)
+	}
+	return ids, requests
+}
@@ -0,0 +1,45 @@
+package basic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanRefresh(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	tests := []struct {
+		name         string
+		items        []RefreshItem
+		budget       RefreshBudget
+		wantIDs      []int
+		wantRequests int
+	}{
+		{
+			name:         "按过期程度排序，从未获取的最先，活跃对象加倍",
+			items:        []RefreshItem{{ID: 1, LastFetched: daysAgo(6)}, {ID: 2, LastFetched: daysAgo(4), Active: true}, {ID: 3}},
+			wantIDs:      []int{3, 2, 1},
+			wantRequests: 3,
+		},
+		{
+			name: "放不下的对象跳过，剩余预算留给后面的对象",
+			items: []RefreshItem{
+				{ID: 1, LastFetched: daysAgo(3), Cost: 4},
+				{ID: 2, LastFetched: daysAgo(2), Cost: 10},
+				{ID: 3, LastFetched: daysAgo(1), Cost: 5},
+			},
+			budget:       RefreshBudget{MaxRequests: 10},
+			wantIDs:      []int{1, 3},
+			wantRequests: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		ids, requests := PlanRefresh(tt.items, tt.budget, now)
+		if !reflect.DeepEqual(ids, tt.wantIDs) || requests != tt.wantRequests {
+			t.Errorf("%s: PlanRefresh() = %v, %d, want %v, %d", tt.name, ids, requests, tt.wantIDs, tt.wantRequests)
+		}
+	}
+}
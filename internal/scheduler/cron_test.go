@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// 2026-03-09 是周一
+	tests := []struct {
+		expr        string
+		match, miss string
+	}{
+		{"*/15 * * * *", "2026-03-10 04:45", "2026-03-10 04:10"},
+		{"0 9-17/4 * * *", "2026-03-10 13:00", "2026-03-10 11:00"},
+		{"0 3 * * 1", "2026-03-09 03:00", "2026-03-10 03:00"},
+		{"0 0 13 * 1", "2026-03-09 00:00", "2026-03-10 00:00"}, // 日和周都有限制时满足其一即可
+		{"@hourly", "2026-03-10 07:00", "2026-03-10 07:30"},
+	}
+
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) error = %v", tt.expr, err)
+		}
+		match, _ := time.ParseInLocation("2006-01-02 15:04", tt.match, time.Local)
+		miss, _ := time.ParseInLocation("2006-01-02 15:04", tt.miss, time.Local)
+		if !schedule.matches(match) || schedule.matches(miss) {
+			t.Errorf("%q: 应命中 %s，不应命中 %s", tt.expr, tt.match, tt.miss)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestPathsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"data/users", "data/users/1/2/3.json", true},
+		{"data/users/", "data/users", true},
+		{"data/users", "data/users_index.jsonl", false},
+	}
+	for _, tt := range tests {
+		if got := pathsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("pathsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
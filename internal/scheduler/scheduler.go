@@ -0,0 +1,288 @@
+package scheduler
+
+import (
+	"bgm-catch/internal/basic"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ------------------------- 定时任务守护进程 -------------------------
+
+const jobLogDir = "logs/scheduler"
+
+// 任务运行记录位于数据目录下
+func historyFile() string {
+	return basic.DataPath("scheduler_history.jsonl")
+}
+
+// 单个定时任务：以子进程运行 subject 或 user 模块，并把 Input 逐行作为交互输入
+type Job struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"`
+	Module   string   `json:"module"` // subject 或 user
+	Input    []string `json:"input"`
+	Files    []string `json:"files"` // 任务会读写的文件或目录，有重叠的任务不会同时运行
+
+	cron *cronSchedule
+}
+
+type Config struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// 任务运行记录，追加写入 historyFile
+type JobRecord struct {
+	Job      string  `json:"job"`
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Duration float64 `json:"duration_seconds"`
+	Outcome  string  `json:"outcome"` // success / failed / skipped
+	Error    string  `json:"error,omitempty"`
+	Log      string  `json:"log,omitempty"`
+}
+
+// 配置文件不存在时写入的默认任务，文件路径位于当前数据目录下
+func defaultConfig() Config {
+	data := basic.DataPath
+	return Config{Jobs: []Job{
+		{Name: "daily-airing", Schedule: "0 4 * * *", Module: "subject", Input: []string{"CAL"},
+			Files: []string{data("anime.json"), data("anime_remap.csv"), data("calendar.json")}},
+		{Name: "weekly-update-anime", Schedule: "0 3 * * 1", Module: "subject", Input: []string{"UA", "all"},
+			Files: []string{data("anime.json"), data("anime_remap.csv"), data("anime_redirects.csv")}},
+		{Name: "monthly-staff", Schedule: "0 2 1 * *", Module: "subject", Input: []string{"AS"},
+			Files: []string{data("anime.json"), data("anime_staffs.json")}},
+		{Name: "monthly-relations", Schedule: "0 5 1 * *", Module: "subject", Input: []string{"AR"},
+			Files: []string{data("anime.json"), data("anime_relations.json")}},
+		{Name: "hourly-stale-users", Schedule: "0 * * * *", Module: "user", Input: []string{"U", "stale", "2000,50m"},
+			Files: []string{data("users"), data("anime_remap.csv")}},
+	}}
+}
+
+type scheduler struct {
+	jobs    []*Job
+	mu      sync.Mutex
+	running map[string]*Job // 正在运行的任务
+	queued  []*Job          // 已到点但因文件冲突等待的任务
+	wg      sync.WaitGroup
+}
+
+// 启动守护进程，按配置文件中的cron表达式运行任务，收到中断信号后等待运行中的任务结束再退出
+func Serve(configPath string) {
+	logFile, err := initLog()
+	if err != nil {
+		log.Fatalf("初始化日志失败: %v", err)
+	}
+	defer logFile.Close()
+
+	// 同一数据目录只允许一个守护进程
+	lock, err := basic.TryLockData(basic.LockScheduler, true)
+	if err != nil {
+		log.Fatalf("无法启动调度守护进程（可能已有守护进程在运行）: %v", err)
+	}
+	defer lock.Unlock()
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatalf("加载任务配置失败: %v", err)
+	}
+
+	s := &scheduler{running: make(map[string]*Job)}
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		if job.cron, err = parseCron(job.Schedule); err != nil {
+			log.Fatalf("任务 %s 的cron表达式无效: %v", job.Name, err)
+		}
+		if job.Module != "subject" && job.Module != "user" {
+			log.Fatalf("任务 %s 的模块无效: %s", job.Name, job.Module)
+		}
+		s.jobs = append(s.jobs, job)
+		log.Printf("已加载任务 %-24s %-16s %s %v", job.Name, job.Schedule, job.Module, job.Input)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		// 对齐到下一分钟
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-stop:
+			log.Println("收到退出信号，等待运行中的任务结束...")
+			s.wg.Wait()
+			return
+		case <-time.After(next.Sub(now)):
+		}
+
+		s.mu.Lock()
+		for _, job := range s.jobs {
+			if job.cron.matches(next) {
+				s.enqueueLocked(job)
+			}
+		}
+		s.dispatchLocked()
+		s.mu.Unlock()
+	}
+}
+
+func (s *scheduler) enqueueLocked(job *Job) {
+	if _, running := s.running[job.Name]; running {
+		log.Printf("任务 %s 仍在运行，跳过本次触发", job.Name)
+		recordHistory(JobRecord{Job: job.Name, Start: time.Now().Format(time.RFC3339), Outcome: "skipped", Error: "上一次运行尚未结束"})
+		return
+	}
+	for _, queued := range s.queued {
+		if queued == job {
+			return
+		}
+	}
+	s.queued = append(s.queued, job)
+}
+
+// 依次启动不与运行中任务冲突的排队任务
+func (s *scheduler) dispatchLocked() {
+	var waiting []*Job
+	for _, job := range s.queued {
+		if conflict := s.conflictLocked(job); conflict != "" {
+			log.Printf("任务 %s 与运行中的任务 %s 存在文件冲突，等待执行", job.Name, conflict)
+			waiting = append(waiting, job)
+			continue
+		}
+		s.running[job.Name] = job
+		s.wg.Add(1)
+		go s.run(job)
+	}
+	s.queued = waiting
+}
+
+func (s *scheduler) conflictLocked(job *Job) string {
+	for name, running := range s.running {
+		for _, a := range job.Files {
+			for _, b := range running.Files {
+				if pathsOverlap(a, b) {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// 相同路径或一方是另一方的上级目录时视为重叠
+func pathsOverlap(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if a == b {
+		return true
+	}
+	sep := string(filepath.Separator)
+	return strings.HasPrefix(a, b+sep) || strings.HasPrefix(b, a+sep)
+}
+
+func (s *scheduler) run(job *Job) {
+	defer s.wg.Done()
+	record := runJob(job)
+	recordHistory(record)
+	log.Printf("任务 %s 结束: %s | 耗时 %.0fs %s", job.Name, record.Outcome, record.Duration, record.Error)
+
+	s.mu.Lock()
+	delete(s.running, job.Name)
+	s.dispatchLocked() // 释放文件后启动等待中的任务
+	s.mu.Unlock()
+}
+
+// 以子进程运行当前程序，输出写入单独的任务日志
+func runJob(job *Job) JobRecord {
+	start := time.Now()
+	record := JobRecord{Job: job.Name, Start: start.Format(time.RFC3339)}
+	finish := func(err error) JobRecord {
+		end := time.Now()
+		record.End = end.Format(time.RFC3339)
+		record.Duration = end.Sub(start).Seconds()
+		record.Outcome = "success"
+		if err != nil {
+			record.Outcome = "failed"
+			record.Error = err.Error()
+		}
+		return record
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return finish(fmt.Errorf("获取程序路径失败: %v", err))
+	}
+	if err := os.MkdirAll(jobLogDir, os.ModePerm); err != nil {
+		return finish(fmt.Errorf("创建任务日志目录失败: %v", err))
+	}
+	record.Log = filepath.Join(jobLogDir, fmt.Sprintf("%s_%s.txt", job.Name, start.Format("20060102_150405")))
+	output, err := os.Create(record.Log)
+	if err != nil {
+		return finish(fmt.Errorf("创建任务日志失败: %v", err))
+	}
+	defer output.Close()
+
+	log.Printf("开始运行任务 %s", job.Name)
+	cmd := exec.Command(executable, "-mode", job.Module)
+	cmd.Stdin = strings.NewReader(strings.Join(job.Input, "\n") + "\n")
+	cmd.Stdout = output
+	cmd.Stderr = output
+	return finish(cmd.Run())
+}
+
+func recordHistory(record JobRecord) {
+	if err := os.MkdirAll(filepath.Dir(historyFile()), os.ModePerm); err != nil {
+		log.Printf("创建任务历史目录失败: %v", err)
+		return
+	}
+	file, err := os.OpenFile(historyFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("打开任务历史失败: %v", err)
+		return
+	}
+	defer file.Close()
+
+	data, _ := json.Marshal(record)
+	file.Write(append(data, '\n'))
+}
+
+func loadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		config = defaultConfig()
+		output, _ := json.MarshalIndent(config, "", "  ")
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			return config, err
+		}
+		log.Printf("配置文件 %s 不存在，已写入默认任务配置", path)
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+func initLog() (*os.File, error) {
+	logDir := "logs"
+	if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	logFile, err := os.Create(fmt.Sprintf("%s/log_scheduler_%s.txt", logDir, time.Now().Format("20060102_150405")))
+	if err != nil {
+		return nil, fmt.Errorf("创建日志文件失败: %v", err)
+	}
+	log.SetOutput(io.MultiWriter(logFile, os.Stdout))
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	return logFile, nil
+}
@@ -0,0 +1,488 @@
+package subject
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- Bangumi Archive 离线数据导入 -------------------------
+// 数据格式见 https://github.com/bangumi/Archive ，压缩包内每个文件为 JSON Lines
+
+type archiveTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type archiveSubject struct {
+	ID           int            `json:"id"`
+	Type         int            `json:"type"`
+	Name         string         `json:"name"`
+	NameCn       string         `json:"name_cn"`
+	Infobox      string         `json:"infobox"`
+	Platform     int            `json:"platform"`
+	Summary      string         `json:"summary"`
+	Nsfw         bool           `json:"nsfw"`
+	Tags         []archiveTag   `json:"tags"`
+	MetaTags     []string       `json:"meta_tags"`
+	Score        float64        `json:"score"`
+	ScoreDetails map[string]int `json:"score_details"`
+	Rank         int            `json:"rank"`
+	Date         string         `json:"date"`
+	Favorite     struct {
+		Wish    int `json:"wish"`
+		Done    int `json:"done"`
+		Doing   int `json:"doing"`
+		OnHold  int `json:"on_hold"`
+		Dropped int `json:"dropped"`
+	} `json:"favorite"`
+	Series bool `json:"series"`
+}
+
+type archivePerson struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Type   int      `json:"type"`
+	Career []string `json:"career"`
+}
+
+type archiveSubjectPerson struct {
+	PersonID  int `json:"person_id"`
+	SubjectID int `json:"subject_id"`
+	Position  int `json:"position"`
+}
+
+type archiveSubjectRelation struct {
+	SubjectID        int `json:"subject_id"`
+	RelationType     int `json:"relation_type"`
+	RelatedSubjectID int `json:"related_subject_id"`
+	Order            int `json:"order"`
+}
+
+type archiveEpisode struct {
+	SubjectID int `json:"subject_id"`
+	Type      int `json:"type"`
+}
+
+// 关系数据中引用的条目只需要少量字段，避免把整个subject文件留在内存中
+type archiveSubjectBrief struct {
+	Name   string
+	NameCn string
+	Type   int
+}
+
+// 动画条目的放送平台
+var archivePlatforms = map[int]string{
+	1: "TV",
+	2: "OVA",
+	3: "剧场版",
+	5: "WEB",
+}
+
+// 动画Staff职位，未收录的职位保留数字编号
+var archivePositions = map[int]string{
+	1:  "原作",
+	2:  "导演",
+	3:  "脚本",
+	4:  "分镜",
+	5:  "演出",
+	6:  "音乐",
+	7:  "人物原案",
+	8:  "人物设定",
+	9:  "构图",
+	10: "系列构成",
+	11: "美术监督",
+	13: "色彩设计",
+	14: "总作画监督",
+	15: "作画监督",
+	16: "机械设定",
+	17: "摄影监督",
+	18: "监修",
+	19: "道具设计",
+	20: "原画",
+	21: "第二原画",
+	22: "动画检查",
+}
+
+// 条目关系类型，未收录的类型归为"其他"
+var archiveRelations = map[int]string{
+	1:  "改编",
+	2:  "前传",
+	3:  "续集",
+	4:  "总集篇",
+	5:  "全集",
+	6:  "番外篇",
+	7:  "角色出演",
+	8:  "相同世界观",
+	9:  "不同世界观",
+	10: "不同演绎",
+	11: "衍生",
+	12: "主线故事",
+	14: "联动",
+	99: "其他",
+}
+
+// 从本地Archive压缩包导入，生成与API抓取结果相同结构的 anime.json / anime_staffs.json / anime_relations.json
+func importArchive(path string) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		log.Fatalf("打开Archive文件失败: %v", err)
+	}
+	defer archive.Close()
+
+	// 1. 条目：筛选动画并记录所有条目的简要信息
+	briefs := make(map[int]archiveSubjectBrief)
+	var imported []JsonSubject
+	err = readArchiveLines(archive, "subject.jsonlines", func(line []byte) error {
+		var s archiveSubject
+		if err := json.Unmarshal(line, &s); err != nil {
+			return err
+		}
+		briefs[s.ID] = archiveSubjectBrief{Name: s.Name, NameCn: s.NameCn, Type: s.Type}
+		if s.Type == 2 && s.Rank != 0 {
+			imported = append(imported, convertArchiveSubject(&s))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("读取条目数据失败: %v", err)
+	}
+	fmt.Printf("条目读取完成，符合条件的动画: %d\n", len(imported))
+
+	// 以导出时间作为获取时间
+	dumpTime := archiveFileTime(archive, "subject.jsonlines").Format("2006-01-02 15:04:05")
+	keep := make(map[int]int, len(imported)) // OriginalID -> imported下标
+	for i := range imported {
+		imported[i].FetchedAt = dumpTime
+		keep[imported[i].OriginalID] = i
+	}
+
+	// 2. 章节：统计话数
+	err = readArchiveLines(archive, "episode.jsonlines", func(line []byte) error {
+		var ep archiveEpisode
+		if err := json.Unmarshal(line, &ep); err != nil {
+			return err
+		}
+		if i, exists := keep[ep.SubjectID]; exists {
+			imported[i].TotalEpisodes++
+			if ep.Type == 0 { // 本篇
+				imported[i].Eps++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("读取章节数据失败，话数将为0: %v", err)
+	}
+
+	// 3. 合并到现有数据，保持已有project_id不变
+	existingList, err := readExistingSubjects()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("读取现有数据失败: %v", err)
+	}
+	existingImages := make(map[int]Images, len(existingList))
+	for _, item := range existingList {
+		existingImages[item.OriginalID] = item.Images
+	}
+	for i := range imported {
+		// Archive中没有图片地址，沿用已有数据
+		imported[i].Images = existingImages[imported[i].OriginalID]
+	}
+
+	changeLog := newChangeLog("IA")
+	existingList = mergeSubjects(existingList, imported, changeLog)
+	changeLog.save()
+
+	projectIDs := make(map[int]int, len(existingList))
+	for _, item := range existingList {
+		projectIDs[item.OriginalID] = item.ProjectID
+	}
+
+	// 4. Staff
+	subjectPersons := make(map[int][]archiveSubjectPerson)
+	neededPersons := make(map[int]struct{})
+	err = readArchiveLines(archive, "subject-persons.jsonlines", func(line []byte) error {
+		var sp archiveSubjectPerson
+		if err := json.Unmarshal(line, &sp); err != nil {
+			return err
+		}
+		if _, exists := projectIDs[sp.SubjectID]; exists {
+			subjectPersons[sp.SubjectID] = append(subjectPersons[sp.SubjectID], sp)
+			neededPersons[sp.PersonID] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("读取条目Staff数据失败: %v", err)
+	}
+
+	persons := make(map[int]archivePerson, len(neededPersons))
+	err = readArchiveLines(archive, "person.jsonlines", func(line []byte) error {
+		var p archivePerson
+		if err := json.Unmarshal(line, &p); err != nil {
+			return err
+		}
+		if _, needed := neededPersons[p.ID]; needed {
+			persons[p.ID] = p
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("读取人物数据失败: %v", err)
+	}
+
+	var staffs []JsonSubjectPersonCollection
+	for subjectID, list := range subjectPersons {
+		collection := JsonSubjectPersonCollection{
+			JsonSubjectPersons: make([]JsonSubjectPerson, 0, len(list)),
+			ProjectID:          projectIDs[subjectID],
+			OriginalID:         subjectID,
+		}
+		for _, sp := range list {
+			p := persons[sp.PersonID]
+			relation, exists := archivePositions[sp.Position]
+			if !exists {
+				relation = strconv.Itoa(sp.Position)
+			}
+			collection.JsonSubjectPersons = append(collection.JsonSubjectPersons, JsonSubjectPerson{
+				Name:     p.Name,
+				Relation: relation,
+				Career:   p.Career,
+				Type:     p.Type,
+				ID:       sp.PersonID,
+			})
+		}
+		staffs = append(staffs, collection)
+	}
+	sort.Slice(staffs, func(i, j int) bool {
+		return staffs[i].ProjectID < staffs[j].ProjectID
+	})
+
+	// 5. 关系
+	subjectRelations := make(map[int][]archiveSubjectRelation)
+	err = readArchiveLines(archive, "subject-relations.jsonlines", func(line []byte) error {
+		var sr archiveSubjectRelation
+		if err := json.Unmarshal(line, &sr); err != nil {
+			return err
+		}
+		if _, exists := projectIDs[sr.SubjectID]; exists {
+			subjectRelations[sr.SubjectID] = append(subjectRelations[sr.SubjectID], sr)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("读取条目关系数据失败: %v", err)
+	}
+
+	var relations []JsonSubjectRelationCollection
+	for subjectID, list := range subjectRelations {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Order < list[j].Order
+		})
+		collection := JsonSubjectRelationCollection{
+			JsonSubjectRelations: make([]JsonSubjectRelation, 0, len(list)),
+			ProjectID:            projectIDs[subjectID],
+			OriginalID:           subjectID,
+		}
+		for _, sr := range list {
+			related := briefs[sr.RelatedSubjectID]
+			relation, exists := archiveRelations[sr.RelationType]
+			if !exists {
+				relation = archiveRelations[99]
+			}
+			collection.JsonSubjectRelations = append(collection.JsonSubjectRelations, JsonSubjectRelation{
+				Name:     related.Name,
+				NameCn:   related.NameCn,
+				Relation: relation,
+				Type:     related.Type,
+				ID:       sr.RelatedSubjectID,
+			})
+		}
+		relations = append(relations, collection)
+	}
+	sort.Slice(relations, func(i, j int) bool {
+		return relations[i].ProjectID < relations[j].ProjectID
+	})
+
+	// 6. 写出
+	if err := os.MkdirAll(DataRoot(), os.ModePerm); err != nil {
+		log.Fatalf("创建data目录失败: %v", err)
+	}
+	if err := saveSubjects(existingList); err != nil {
+		log.Fatalf("条目数据写入失败: %v", err)
+	}
+	if err := saveStaffs(staffs); err != nil {
+		log.Fatalf("Staff数据写入失败: %v", err)
+	}
+	if err := saveRelations(relations); err != nil {
+		log.Fatalf("关系数据写入失败: %v", err)
+	}
+	updateRemap(existingList)
+
+	fmt.Printf("Archive导入完成！条目: %d | Staff: %d | 关系: %d\n", len(existingList), len(staffs), len(relations))
+}
+
+func writeJSONFile(path string, v interface{}) {
+	if err := writeJSON(path, v); err != nil {
+		log.Fatalf("文件写入失败: %v", err)
+	}
+}
+
+func findArchiveFile(archive *zip.ReadCloser, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name || strings.HasSuffix(f.Name, "/"+name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func archiveFileTime(archive *zip.ReadCloser, name string) time.Time {
+	if entry := findArchiveFile(archive, name); entry != nil && !entry.Modified.IsZero() {
+		return entry.Modified
+	}
+	return time.Now()
+}
+
+// 逐行读取压缩包中的JSON Lines文件
+func readArchiveLines(archive *zip.ReadCloser, name string, handle func(line []byte) error) error {
+	entry := findArchiveFile(archive, name)
+	if entry == nil {
+		return fmt.Errorf("压缩包中没有 %s", name)
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	reader := bufio.NewReaderSize(rc, 1<<20)
+	lineNo := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			lineNo++
+			if herr := handle(line); herr != nil {
+				return fmt.Errorf("%s 第 %d 行: %v", name, lineNo, herr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func convertArchiveSubject(s *archiveSubject) JsonSubject {
+	subject := JsonSubject{
+		Collection: FileCollection{
+			Collect: s.Favorite.Done,
+			Doing:   s.Favorite.Doing,
+			Dropped: s.Favorite.Dropped,
+			OnHold:  s.Favorite.OnHold,
+			Wish:    s.Favorite.Wish,
+		},
+		Date:       s.Date,
+		OriginalID: s.ID,
+		Infobox:    parseWikiInfobox(s.Infobox),
+		MetaTags:   make([]interface{}, 0, len(s.MetaTags)),
+		Name:       s.Name,
+		NameCn:     s.NameCn,
+		Nsfw:       s.Nsfw,
+		Platform:   archivePlatforms[s.Platform],
+		Series:     s.Series,
+		Summary:    s.Summary,
+		Tags:       make([]FileTag, 0, len(s.Tags)),
+		Type:       s.Type,
+	}
+	if subject.Platform == "" {
+		subject.Platform = "其他"
+	}
+	for _, t := range s.MetaTags {
+		subject.MetaTags = append(subject.MetaTags, t)
+	}
+	for _, t := range s.Tags {
+		subject.Tags = append(subject.Tags, FileTag{Name: t.Name, Count: t.Count})
+	}
+
+	d := s.ScoreDetails
+	subject.Rating = Rating{
+		Count: RatingCount{
+			One: d["1"], Two: d["2"], Three: d["3"], Four: d["4"], Five: d["5"],
+			Six: d["6"], Eight: d["8"], Nine: d["9"], Ten: d["10"],
+		},
+		Rank:  s.Rank,
+		Score: s.Score,
+	}
+	for _, count := range d {
+		subject.Rating.Total += count
+	}
+	return subject
+}
+
+// 解析wiki格式的infobox，输出与API一致的结构：
+// 普通字段的值为字符串，数组字段的值为 [{"k": ..., "v": ...}] 或 [{"v": ...}]
+func parseWikiInfobox(wiki string) []Infobox {
+	result := make([]Infobox, 0)
+	var (
+		arrayKey   string
+		arrayItems []interface{}
+		inArray    bool
+	)
+
+	for _, line := range strings.Split(wiki, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "{{Infobox") || line == "}}" {
+			continue
+		}
+
+		if inArray {
+			if line == "}" {
+				result = append(result, Infobox{Key: arrayKey, Value: arrayItems})
+				inArray = false
+				continue
+			}
+			item := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			if k, v, found := strings.Cut(item, "|"); found {
+				arrayItems = append(arrayItems, map[string]string{"k": strings.TrimSpace(k), "v": strings.TrimSpace(v)})
+			} else {
+				arrayItems = append(arrayItems, map[string]string{"v": strings.TrimSpace(item)})
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		key, value, found := strings.Cut(line[1:], "=")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if value == "{" {
+			arrayKey = key
+			arrayItems = make([]interface{}, 0)
+			inArray = true
+			continue
+		}
+		result = append(result, Infobox{Key: key, Value: value})
+	}
+	if inArray {
+		result = append(result, Infobox{Key: arrayKey, Value: arrayItems})
+	}
+	return result
+}
@@ -0,0 +1,173 @@
+package subject
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 放送日历追踪 -------------------------
+
+func calendarFile() string { return DataPath("calendar.json") }
+
+type calendarDay struct {
+	Weekday struct {
+		ID int    `json:"id"`
+		Cn string `json:"cn"`
+	} `json:"weekday"`
+	Items []struct {
+		ID     int    `json:"id"`
+		Type   int    `json:"type"`
+		Name   string `json:"name"`
+		NameCn string `json:"name_cn"`
+	} `json:"items"`
+}
+
+type JsonCalendarItem struct {
+	OriginalID int    `json:"id"`
+	ProjectID  int    `json:"project_id"`
+	Name       string `json:"name"`
+	NameCn     string `json:"name_cn"`
+	Weekday    int    `json:"weekday"`
+}
+
+// 本地记录的放送日历，RefreshedAt 用于控制每天只刷新一次
+type JsonCalendar struct {
+	RefreshedAt string             `json:"refreshed_at"`
+	Items       []JsonCalendarItem `json:"items"`
+}
+
+// 读取每周放送日历，收录新番并刷新放送中条目的话数、评分和收藏数
+func calendarMode(token string) {
+	days, err := fetchCalendar(token)
+	if err != nil {
+		log.Fatalf("获取放送日历失败: %v", err)
+	}
+
+	weekdays := make(map[int]int) // OriginalID -> 星期
+	for _, day := range days {
+		for _, item := range day.Items {
+			if item.Type == 2 {
+				weekdays[item.ID] = day.Weekday.ID
+			}
+		}
+	}
+	fmt.Printf("放送日历中共有 %d 个动画条目\n", len(weekdays))
+
+	existingList, err := readExistingSubjects()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("读取现有数据失败: %v", err)
+	}
+	indexByID := make(map[int]int, len(existingList))
+	for i, item := range existingList {
+		indexByID[item.OriginalID] = i
+	}
+
+	// 今天已经刷新过时只收录新番，不再重复刷新
+	previous, _ := readCalendar()
+	today := time.Now().Format("2006-01-02")
+	refreshedToday := len(previous.RefreshedAt) >= 10 && previous.RefreshedAt[:10] == today
+
+	var newIDs, airingIDs []int
+	for id := range weekdays {
+		if _, exists := indexByID[id]; exists {
+			airingIDs = append(airingIDs, id)
+		} else {
+			newIDs = append(newIDs, id)
+		}
+	}
+
+	changeLog := newChangeLog("CAL")
+
+	// 新番尚无排名，放宽排名条件收录
+	if len(newIDs) > 0 {
+		fmt.Printf("收录 %d 个新番...\n", len(newIDs))
+		newSubjects, _ := fetchByIdList(newIDs, token, true)
+		existingList = mergeSubjects(existingList, newSubjects, changeLog)
+	}
+
+	if refreshedToday {
+		fmt.Printf("今天（%s）已刷新过放送中条目，跳过刷新\n", previous.RefreshedAt)
+	} else if len(airingIDs) > 0 {
+		fmt.Printf("刷新 %d 个放送中条目...\n", len(airingIDs))
+		refreshed, _ := fetchByIdList(airingIDs, token, true)
+		for i := range refreshed {
+			// 条目已被合并时返回的是合并目标，不在原有列表中，留给更新模式的重定向处理
+			idx, ok := indexByID[refreshed[i].OriginalID]
+			if !ok {
+				log.Printf("放送中条目刷新返回了未收录的条目 %d（可能已被合并），跳过", refreshed[i].OriginalID)
+				continue
+			}
+			existing := &existingList[idx]
+			updated := *existing
+			refreshAiringFields(&updated, &refreshed[i])
+			changeLog.addChanges("subject", existing.OriginalID, existing.ProjectID, existing.Name,
+				diffSubject(existing, &updated))
+			*existing = updated
+		}
+	}
+
+	// 标记放送状态
+	calendar := JsonCalendar{RefreshedAt: previous.RefreshedAt}
+	if !refreshedToday {
+		calendar.RefreshedAt = time.Now().Format("2006-01-02 15:04:05")
+	}
+	for i := range existingList {
+		item := &existingList[i]
+		weekday, airing := weekdays[item.OriginalID]
+		if item.OnAir != airing {
+			changeLog.addChanges("subject", item.OriginalID, item.ProjectID, item.Name,
+				[]FieldChange{{Field: "on_air", Old: item.OnAir, New: airing}})
+		}
+		item.OnAir = airing
+		item.AirWeekday = weekday
+		if airing {
+			calendar.Items = append(calendar.Items, JsonCalendarItem{
+				OriginalID: item.OriginalID,
+				ProjectID:  item.ProjectID,
+				Name:       item.Name,
+				NameCn:     item.NameCn,
+				Weekday:    weekday,
+			})
+		}
+	}
+	changeLog.save()
+
+	if err := os.MkdirAll(DataRoot(), os.ModePerm); err != nil {
+		log.Fatalf("创建data目录失败: %v", err)
+	}
+	if err := saveSubjects(existingList); err != nil {
+		log.Fatalf("文件写入失败: %v", err)
+	}
+	writeJSONFile(calendarFile(), calendar)
+	fmt.Printf("放送日历更新完成！放送中条目: %d | 现有条目数: %d\n", len(calendar.Items), len(existingList))
+}
+
+// 放送中的条目只刷新变化频繁的字段
+func refreshAiringFields(existing *JsonSubject, newData *JsonSubject) {
+	existing.Eps = newData.Eps
+	existing.TotalEpisodes = newData.TotalEpisodes
+	existing.Rating = newData.Rating
+	existing.Collection = newData.Collection
+	existing.FetchedAt = newData.FetchedAt
+}
+
+func fetchCalendar(token string) ([]calendarDay, error) {
+	var days []calendarDay
+	err := getAPIJSON("https://api.bgm.tv/calendar", token, &days)
+	return days, err
+}
+
+func readCalendar() (JsonCalendar, error) {
+	var calendar JsonCalendar
+	data, err := os.ReadFile(calendarFile())
+	if err != nil {
+		return calendar, err
+	}
+	err = json.Unmarshal(data, &calendar)
+	return calendar, err
+}
@@ -0,0 +1,258 @@
+package subject
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 更新变更日志 -------------------------
+
+func changelogDir() string { return DataPath("changelogs") }
+
+// 单个字段的变化。标量字段使用Old/New，集合字段（标签、Staff、关系）使用Added/Removed
+type FieldChange struct {
+	Field   string      `json:"field"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Added   []string    `json:"added,omitempty"`
+	Removed []string    `json:"removed,omitempty"`
+}
+
+type SubjectChange struct {
+	OriginalID int           `json:"id"`
+	ProjectID  int           `json:"project_id"`
+	Name       string        `json:"name"`
+	Kind       string        `json:"kind"` // subject / staff / relation
+	IsNew      bool          `json:"is_new,omitempty"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+}
+
+type ChangeLog struct {
+	Mode    string          `json:"mode"`
+	Time    string          `json:"time"`
+	Entries []SubjectChange `json:"entries"`
+}
+
+func newChangeLog(mode string) *ChangeLog {
+	return &ChangeLog{
+		Mode: mode,
+		Time: time.Now().Format("2006-01-02 15:04:05"),
+	}
+}
+
+// 条目ID到名称的映射，Staff和关系的变更日志据此填写条目名称，读取失败时返回空表
+func subjectNames() map[int]string {
+	names := make(map[int]string)
+	currentStore().EachSubject(func(item JsonSubject) error {
+		names[item.OriginalID] = item.Name
+		return nil
+	})
+	return names
+}
+
+// 记录新增条目
+func (cl *ChangeLog) addNew(kind string, originalID, projectID int, name string) {
+	cl.Entries = append(cl.Entries, SubjectChange{
+		OriginalID: originalID,
+		ProjectID:  projectID,
+		Name:       name,
+		Kind:       kind,
+		IsNew:      true,
+	})
+}
+
+// 记录已有条目的变化，无变化时忽略
+func (cl *ChangeLog) addChanges(kind string, originalID, projectID int, name string, changes []FieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	cl.Entries = append(cl.Entries, SubjectChange{
+		OriginalID: originalID,
+		ProjectID:  projectID,
+		Name:       name,
+		Kind:       kind,
+		Changes:    changes,
+	})
+}
+
+// 比较两个条目的字段差异（需在updateExistingFields之前调用）
+func diffSubject(old, new *JsonSubject) []FieldChange {
+	var changes []FieldChange
+	scalar := func(field string, o, n interface{}) {
+		if o != n {
+			changes = append(changes, FieldChange{Field: field, Old: o, New: n})
+		}
+	}
+
+	scalar("name", old.Name, new.Name)
+	scalar("name_cn", old.NameCn, new.NameCn)
+	scalar("date", old.Date, new.Date)
+	scalar("platform", old.Platform, new.Platform)
+	scalar("eps", old.Eps, new.Eps)
+	scalar("total_episodes", old.TotalEpisodes, new.TotalEpisodes)
+	scalar("volumes", old.Volumes, new.Volumes)
+	scalar("type", old.Type, new.Type)
+	scalar("nsfw", old.Nsfw, new.Nsfw)
+	scalar("locked", old.Locked, new.Locked)
+	scalar("series", old.Series, new.Series)
+	scalar("rating.rank", old.Rating.Rank, new.Rating.Rank)
+	scalar("rating.score", old.Rating.Score, new.Rating.Score)
+	if old.Summary != new.Summary {
+		// 简介内容较长，只记录发生了变化
+		changes = append(changes, FieldChange{Field: "summary"})
+	}
+
+	oldTags := make([]string, 0, len(old.Tags))
+	for _, t := range old.Tags {
+		oldTags = append(oldTags, t.Name)
+	}
+	newTags := make([]string, 0, len(new.Tags))
+	for _, t := range new.Tags {
+		newTags = append(newTags, t.Name)
+	}
+	if added, removed := diffStringSet(oldTags, newTags); len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, FieldChange{Field: "tags", Added: added, Removed: removed})
+	}
+	return changes
+}
+
+func diffStaffs(old, new *JsonSubjectPersonCollection) []FieldChange {
+	key := func(p JsonSubjectPerson) string {
+		return fmt.Sprintf("%d:%s(%s)", p.ID, p.Name, p.Relation)
+	}
+	var oldKeys, newKeys []string
+	for _, p := range old.JsonSubjectPersons {
+		oldKeys = append(oldKeys, key(p))
+	}
+	for _, p := range new.JsonSubjectPersons {
+		newKeys = append(newKeys, key(p))
+	}
+	if added, removed := diffStringSet(oldKeys, newKeys); len(added) > 0 || len(removed) > 0 {
+		return []FieldChange{{Field: "persons", Added: added, Removed: removed}}
+	}
+	return nil
+}
+
+func diffRelations(old, new *JsonSubjectRelationCollection) []FieldChange {
+	key := func(r JsonSubjectRelation) string {
+		return fmt.Sprintf("%d:%s(%s)", r.ID, r.Name, r.Relation)
+	}
+	var oldKeys, newKeys []string
+	for _, r := range old.JsonSubjectRelations {
+		oldKeys = append(oldKeys, key(r))
+	}
+	for _, r := range new.JsonSubjectRelations {
+		newKeys = append(newKeys, key(r))
+	}
+	if added, removed := diffStringSet(oldKeys, newKeys); len(added) > 0 || len(removed) > 0 {
+		return []FieldChange{{Field: "relations", Added: added, Removed: removed}}
+	}
+	return nil
+}
+
+// 计算两个字符串集合的增减
+func diffStringSet(old, new []string) (added, removed []string) {
+	oldSet := make(map[string]struct{}, len(old))
+	for _, s := range old {
+		oldSet[s] = struct{}{}
+	}
+	newSet := make(map[string]struct{}, len(new))
+	for _, s := range new {
+		newSet[s] = struct{}{}
+		if _, exists := oldSet[s]; !exists {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if _, exists := newSet[s]; !exists {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// 写出结构化日志（JSON）和可读摘要（TXT）
+func (cl *ChangeLog) save() {
+	if err := os.MkdirAll(changelogDir(), os.ModePerm); err != nil {
+		log.Printf("创建变更日志目录失败: %v", err)
+		return
+	}
+	base := filepath.Join(changelogDir(), fmt.Sprintf("%s_%s", strings.ToLower(cl.Mode), time.Now().Format("20060102_150405")))
+
+	output, err := json.MarshalIndent(cl, "", "  ")
+	if err != nil {
+		log.Printf("变更日志JSON生成失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(base+".json", output, 0644); err != nil {
+		log.Printf("变更日志写入失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(base+".txt", []byte(cl.summary()), 0644); err != nil {
+		log.Printf("变更摘要写入失败: %v", err)
+		return
+	}
+	fmt.Printf("变更日志已写入 %s.json / %s.txt\n", base, base)
+}
+
+func (cl *ChangeLog) summary() string {
+	var sb strings.Builder
+	newCount, changedCount := 0, 0
+	fieldCount := make(map[string]int)
+	for _, e := range cl.Entries {
+		if e.IsNew {
+			newCount++
+			continue
+		}
+		changedCount++
+		for _, c := range e.Changes {
+			fieldCount[e.Kind+"."+c.Field]++
+		}
+	}
+
+	fmt.Fprintf(&sb, "模式: %s | 时间: %s\n", cl.Mode, cl.Time)
+	fmt.Fprintf(&sb, "新增条目: %d | 变化条目: %d\n", newCount, changedCount)
+	fields := make([]string, 0, len(fieldCount))
+	for f := range fieldCount {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		fmt.Fprintf(&sb, "  %-24s %d\n", f, fieldCount[f])
+	}
+	sb.WriteString("\n")
+
+	for _, e := range cl.Entries {
+		if e.IsNew {
+			fmt.Fprintf(&sb, "[+] %s ID=%d project_id=%d %s\n", e.Kind, e.OriginalID, e.ProjectID, e.Name)
+			continue
+		}
+		fmt.Fprintf(&sb, "[*] %s ID=%d project_id=%d %s\n", e.Kind, e.OriginalID, e.ProjectID, e.Name)
+		for _, c := range e.Changes {
+			switch {
+			case len(c.Added) > 0 || len(c.Removed) > 0:
+				if len(c.Added) > 0 {
+					fmt.Fprintf(&sb, "    %s 新增: %s\n", c.Field, strings.Join(c.Added, ", "))
+				}
+				if len(c.Removed) > 0 {
+					fmt.Fprintf(&sb, "    %s 移除: %s\n", c.Field, strings.Join(c.Removed, ", "))
+				}
+			case c.Old == nil && c.New == nil:
+				fmt.Fprintf(&sb, "    %s 已变化\n", c.Field)
+			default:
+				fmt.Fprintf(&sb, "    %s: %v -> %v\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package subject
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 全局配置 -------------------------
+// 数据文件路径，均位于数据目录下（见 DataRoot）
+func animeFile() string         { return DataPath("anime.json") }
+func animeStaffFile() string    { return DataPath("anime_staffs.json") }
+func animeRelationFile() string { return DataPath("anime_relations.json") }
+func animeRemapFile() string    { return DataPath("anime_remap.csv") }
+func animeRedirectFile() string { return DataPath("anime_redirects.csv") }
+func probeStateFile() string    { return DataPath("probe_state.json") }
+
+// 新条目探测：连续多少次404后停止，以及跳跃步长上限
+var (
+	probeMaxMisses = envInt("PROBE_MAX_MISSES", 200)
+	probeMaxStep   = envInt("PROBE_MAX_STEP", 32)
+)
+
+// 条目缺失时的处理策略
+const (
+	policyKeep      = "keep"      // 保留旧数据不做处理
+	policyTombstone = "tombstone" // 保留条目但标记状态
+	policyRedirect  = "redirect"  // 移除条目并将用户交互重定向到合并目标（仅对合并条目有效）
+)
+
+// 缺失条目的分类
+const (
+	missingNotFound = "deleted"  // 接口返回404
+	missingMerged   = "merged"   // 返回的ID与请求ID不同，已被合并到其他条目
+	missingFiltered = "filtered" // 条目仍存在，但不再满足类型/排名条件
+)
+
+// 各类缺失条目的处理策略，可通过环境变量覆盖
+var missingPolicies = map[string]string{
+	missingNotFound: envPolicy("POLICY_DELETED", policyKeep),
+	missingMerged:   envPolicy("POLICY_MERGED", policyKeep),
+	missingFiltered: envPolicy("POLICY_FILTERED", policyKeep),
+}
+
+func envPolicy(key, def string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	switch value {
+	case "":
+		return def
+	case policyKeep, policyTombstone, policyRedirect:
+		return value
+	default:
+		log.Printf("环境变量 %s 的值 %q 无效，使用默认策略 %s", key, value, def)
+		return def
+	}
+}
+
+func envInt(key string, def int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("环境变量 %s 的值 %q 无效，使用默认值 %d", key, value, def)
+		return def
+	}
+	return n
+}
@@ -3,40 +3,142 @@ package subject
 import (
 	"encoding/csv"
 	"encoding/json"
-	"io/ioutil"
-	"log"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+
+	. "bgm-catch/internal/basic"
 )
 
-// 读取现有数据文件
-func readExistingSubjects() ([]JsonSubject, error) {
-	fileData, err := ioutil.ReadFile("data/anime.json")
-	if err != nil {
-		return nil, err
-	}
+// ------------------------- 文件实现 -------------------------
+// 与原有目录结构一致：条目、Staff和关系各一个JSON文件，映射表为CSV
+
+type fsStore struct{}
 
+func (fsStore) LoadSubjects() ([]JsonSubject, error) {
 	var existingList []JsonSubject
-	if err := json.Unmarshal(fileData, &existingList); err != nil {
+	if err := readJSONFile(FindCompressed(animeFile()), &existingList); err != nil {
 		return nil, err
 	}
 	return existingList, nil
 }
 
-func readExsitingStaffs() {
+func (fsStore) SaveSubjects(list []JsonSubject) error {
+	return saveOutput(animeFile(), list)
+}
+
+func (fsStore) LoadStaffs() ([]JsonSubjectPersonCollection, error) {
+	var staffs []JsonSubjectPersonCollection
+	if err := readJSONFile(FindCompressed(animeStaffFile()), &staffs); err != nil {
+		return nil, err
+	}
+	return staffs, nil
+}
+
+func (fsStore) SaveStaffs(staffs []JsonSubjectPersonCollection) error {
+	return saveOutput(animeStaffFile(), staffs)
+}
+
+func (fsStore) LoadRelations() ([]JsonSubjectRelationCollection, error) {
+	var relations []JsonSubjectRelationCollection
+	if err := readJSONFile(FindCompressed(animeRelationFile()), &relations); err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
+func (fsStore) SaveRelations(relations []JsonSubjectRelationCollection) error {
+	return saveOutput(animeRelationFile(), relations)
+}
+
+func (fsStore) SaveIDMap(list []JsonSubject) error {
+	return writeRemapCSV(list)
+}
+
+func (fsStore) EachSubject(fn func(JsonSubject) error) error {
+	return eachJSONElement(FindCompressed(animeFile()), fn)
+}
+
+func (fsStore) EachStaff(fn func(JsonSubjectPersonCollection) error) error {
+	return eachJSONElement(FindCompressed(animeStaffFile()), fn)
+}
+
+func (fsStore) EachRelation(fn func(JsonSubjectRelationCollection) error) error {
+	return eachJSONElement(FindCompressed(animeRelationFile()), fn)
+}
+
+// 按 COMPRESS 中 subjects 的设置决定是否压缩，并删除其他压缩方式的旧文件
+func saveOutput(base string, v interface{}) error {
+	path := OutputPath("subjects", base)
+	if err := writeJSON(path, v); err != nil {
+		return err
+	}
+	return RemoveOtherVariants(base, path)
+}
+
+// 按扩展名自动解压
+func readJSONFile(path string, v interface{}) error {
+	fileData, err := ReadCompressedFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fileData, v)
+}
+
+// 逐个解码JSON数组中的元素，不把整个文件读入内存
+func eachJSONElement[T any](path string, fn func(T) error) error {
+	reader, err := OpenCompressed(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if token == nil {
+		return nil // 空列表保存为 null
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("%s: 不是JSON数组", path)
+	}
+	for decoder.More() {
+		var item T
+		if err := decoder.Decode(&item); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// 按扩展名压缩
+func writeJSON(path string, v interface{}) error {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSON生成失败: %v", err)
+	}
+	return WriteCompressedFile(path, output)
 }
 
 // ------------------------- 整理csv功能 -------------------------
-func updateRemap(data []JsonSubject) {
-	file, err := os.Create("data/anime_remap.csv")
+func writeRemapCSV(data []JsonSubject) error {
+	if err := os.MkdirAll(filepath.Dir(animeRemapFile()), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(animeRemapFile())
 	if err != nil {
-		log.Fatalf("创建CSV文件失败: %v", err)
+		return fmt.Errorf("创建CSV文件失败: %v", err)
 	}
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
 	// 写入CSV头
 	writer.Write([]string{"project_id", "original_id"})
@@ -45,4 +147,73 @@ func updateRemap(data []JsonSubject) {
 	for _, item := range data {
 		writer.Write([]string{strconv.Itoa(item.ProjectID), strconv.Itoa(item.OriginalID)})
 	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ------------------------- 重定向表 -------------------------
+
+// 读取被合并条目到目标条目的重定向表（original_id -> target_id）
+func readRedirects() (map[int]int, error) {
+	redirects := make(map[int]int)
+	file, err := os.Open(animeRedirectFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return redirects, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		if i == 0 || len(record) < 2 {
+			continue // 跳过标题行
+		}
+		from, _ := strconv.Atoi(record[0])
+		to, _ := strconv.Atoi(record[1])
+		redirects[from] = to
+	}
+	return redirects, nil
+}
+
+func saveRedirects(redirects map[int]int) error {
+	file, err := os.Create(animeRedirectFile())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"original_id", "target_id"})
+	ids := make([]int, 0, len(redirects))
+	for id := range redirects {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		writer.Write([]string{strconv.Itoa(id), strconv.Itoa(redirects[id])})
+	}
+	return nil
+}
+
+// ------------------------- 压缩转换 -------------------------
+
+// 把已有的条目、Staff和关系数据转换为指定压缩方式，内容不变
+func CompressData(method string) error {
+	for _, base := range []string{animeFile(), animeStaffFile(), animeRelationFile()} {
+		path, err := ConvertOutputFile(base, method)
+		if err != nil {
+			return err
+		}
+		if path != "" {
+			fmt.Printf("已转换 %s\n", path)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,165 @@
+package subject
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly/v2"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 目录（index）作为ID来源 -------------------------
+
+func indicesDir() string { return DataPath("indices") }
+
+// 本地记录的目录信息，用于在目录变化时刷新数据集
+type JsonIndex struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"desc"`
+	Total       int    `json:"total"`
+	Subjects    []int  `json:"subjects"`
+	CatchTime   string `json:"catch_time"`
+}
+
+// 获取目录信息和其中的动画条目，并与本地记录比较后保存
+func fetchIndex(indexID int, token string) (JsonIndex, error) {
+	index := JsonIndex{ID: indexID}
+
+	var meta struct {
+		Title string `json:"title"`
+		Desc  string `json:"desc"`
+		Total int    `json:"total"`
+	}
+	if err := getAPIJSON(fmt.Sprintf("https://api.bgm.tv/v0/indices/%d", indexID), token, &meta); err != nil {
+		return index, err
+	}
+	index.Title = meta.Title
+	index.Description = meta.Desc
+
+	limit := 50
+	offset := 0
+	for {
+		var page struct {
+			Data []struct {
+				ID   int `json:"id"`
+				Type int `json:"type"`
+			} `json:"data"`
+			Total int `json:"total"`
+		}
+		url := fmt.Sprintf("https://api.bgm.tv/v0/indices/%d/subjects?type=2&limit=%d&offset=%d", indexID, limit, offset)
+		if err := getAPIJSON(url, token, &page); err != nil {
+			return index, err
+		}
+
+		for _, item := range page.Data {
+			if item.Type == 2 {
+				index.Subjects = append(index.Subjects, item.ID)
+			}
+		}
+		index.Total = page.Total
+
+		offset += limit
+		if len(page.Data) == 0 || offset >= page.Total {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	sort.Ints(index.Subjects)
+	index.CatchTime = time.Now().Format("2006-01-02 15:04:05")
+
+	// 与上次记录比较目录成员变化
+	if previous, err := readIndex(indexID); err == nil {
+		oldIDs := make([]string, 0, len(previous.Subjects))
+		for _, id := range previous.Subjects {
+			oldIDs = append(oldIDs, strconv.Itoa(id))
+		}
+		newIDs := make([]string, 0, len(index.Subjects))
+		for _, id := range index.Subjects {
+			newIDs = append(newIDs, strconv.Itoa(id))
+		}
+		added, removed := diffStringSet(oldIDs, newIDs)
+		log.Printf("目录 %d（%s）自 %s 以来新增 %d 个条目，移除 %d 个条目: +%v -%v",
+			indexID, index.Title, previous.CatchTime, len(added), len(removed), added, removed)
+	}
+
+	if err := saveIndex(index); err != nil {
+		log.Printf("保存目录 %d 记录失败: %v", indexID, err)
+	}
+	fmt.Printf("目录 %d（%s）包含 %d 个动画条目\n", indexID, index.Title, len(index.Subjects))
+	return index, nil
+}
+
+func getAPIJSON(url string, token string, v interface{}) error {
+	var reqErr error
+	c := colly.NewCollector()
+	c.SetRequestTimeout(60 * time.Second)
+	if token != "" {
+		c.OnRequest(func(r *colly.Request) {
+			r.Headers.Set("Authorization", "Bearer "+token)
+		})
+	}
+	c.OnResponse(func(r *colly.Response) {
+		if err := json.Unmarshal(r.Body, v); err != nil {
+			reqErr = fmt.Errorf("解析失败 %s: %v", url, err)
+		}
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		reqErr = fmt.Errorf("请求失败 %s: %v", url, err)
+	})
+
+	if err := c.Visit(url); err != nil && reqErr == nil {
+		reqErr = err
+	}
+	c.Wait()
+	return reqErr
+}
+
+func readIndex(indexID int) (JsonIndex, error) {
+	var index JsonIndex
+	data, err := os.ReadFile(filepath.Join(indicesDir(), fmt.Sprintf("%d.json", indexID)))
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, err
+}
+
+func saveIndex(index JsonIndex) error {
+	if err := os.MkdirAll(indicesDir(), os.ModePerm); err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(indicesDir(), fmt.Sprintf("%d.json", index.ID)), output, 0644)
+}
+
+func readRecordedIndexIDs() ([]int, error) {
+	entries, err := os.ReadDir(indicesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json")); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -2,11 +2,13 @@ package subject
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
+	"iter"
 	"log"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	. "bgm-catch/internal/basic"
 )
@@ -21,7 +23,11 @@ const tips = "请选择以下选项：\n" +
 	"US（使用动画ID更新Staff）\n" +
 	"CR（使用动画ID下载关系数据）\n" +
 	"AR（下载全部动画的关系数据）\n" +
-	"UR（更新关系数据）"
+	"UR（更新关系数据）\n" +
+	"IA（从本地Bangumi Archive压缩包导入动画、Staff和关系数据）\n" +
+	"SA（按关键词、标签、日期、排名、评分搜索并下载/更新动画）\n" +
+	"CAL（根据放送日历收录新番并刷新放送中条目）\n" +
+	"NA（从已知最大ID向后探测新建条目）"
 
 func Main() {
 	logFile, err := initLog()
@@ -30,12 +36,20 @@ func Main() {
 	}
 	defer logFile.Close()
 
+	// 与其他写入条目数据的进程（手动运行或定时任务）互斥
+	lock, err := LockData(LockSubject, true)
+	if err != nil {
+		log.Fatalf("获取数据锁失败: %v", err)
+	}
+	defer lock.Unlock()
+
 	token := os.Getenv("TOKEN")
 	if token == "" {
 		log.Println("警告：未设置TOKEN环境变量，可能无法获取完整数据")
 	}
 
 	reader := bufio.NewReader(os.Stdin)
+	SetStdin(reader)
 
 	fmt.Print(tips)
 	mode, _ := reader.ReadString('\n')
@@ -44,15 +58,15 @@ func Main() {
 	switch strings.ToUpper(mode) {
 	case "CA", "CREATE", "CREATE_ANIME":
 		// 创建模式处理
-		fmt.Print("请输入ID列表（例如：1,2,5-10,12）: ")
+		fmt.Print("请输入ID列表（例如：1,2,5-10,12,!7 或 index:目录ID、@ids.txt、subjects-missing-staff）: ")
 		idInput, _ := reader.ReadString('\n')
 		idInput = strings.TrimSpace(idInput)
 
-		ids, err := ParseIDList(idInput)
+		expr, err := ParseIDExpr(idInput, ScopeSubject)
 		if err != nil {
 			log.Fatalf("ID列表解析失败: %v", err)
 		}
-		createMode(ids, token)
+		createMode(expr.All(), token)
 		existingList, err := readExistingSubjects()
 		if err != nil {
 			log.Fatalf("读取现有数据失败: %v", err)
@@ -61,27 +75,49 @@ func Main() {
 
 	case "UA", "UPDATE", "UPDATE_ANIME":
 		// 更新模式处理
-		fmt.Print("请输入ID列表（例如：1,2,5-10,12）或输入'all'更新全部条目: ")
+		fmt.Print("请输入ID列表（例如：1,2,5-10,12,!7 或 index:目录ID、@ids.txt、subjects-missing-staff）或输入'all'更新全部条目，输入'stale'按过期程度在预算内刷新: ")
 		idInput, _ := reader.ReadString('\n')
 		idInput = strings.TrimSpace(idInput)
 
-		var ids []int
+		if strings.ToLower(idInput) == "stale" {
+			fmt.Print("请输入本次预算（请求数和/或时长，例如：2000 或 30m 或 2000,30m，留空不限）: ")
+			budgetInput, _ := reader.ReadString('\n')
+			budget, err := ParseRefreshBudget(budgetInput)
+			if err != nil {
+				log.Fatalf("预算解析失败: %v", err)
+			}
+			ids, requests, err := planStaleSubjects(budget)
+			if err != nil {
+				log.Fatalf("生成刷新计划失败: %v", err)
+			}
+			log.Printf("刷新计划: %d 个条目，预计 %d 次请求", len(ids), requests)
+			updateModeWithin(slices.Values(ids), token, budget.Deadline(time.Now()))
+			existingList, err := readExistingSubjects()
+			if err != nil {
+				log.Fatalf("读取现有数据失败: %v", err)
+			}
+			updateRemap(existingList)
+			return
+		}
+		var ids iter.Seq[int]
 		if strings.ToLower(idInput) == "all" {
 			// 读取现有数据获取所有ID
 			existingList, err := readExistingSubjects()
 			if err != nil {
 				log.Fatalf("读取现有数据失败: %v", err)
 			}
+			allIDs := make([]int, 0, len(existingList))
 			for _, item := range existingList {
-				ids = append(ids, item.OriginalID)
+				allIDs = append(allIDs, item.OriginalID)
 			}
+			ids = slices.Values(allIDs)
 		} else {
-			// 正常解析ID列表
-			parsedIDs, err := ParseIDList(idInput)
+			// 正常解析ID表达式，按批次展开
+			expr, err := ParseIDExpr(idInput, ScopeSubject)
 			if err != nil {
 				log.Fatalf("ID列表解析失败: %v", err)
 			}
-			ids = parsedIDs
+			ids = expr.All()
 		}
 		updateMode(ids, token)
 		existingList, err := readExistingSubjects()
@@ -113,35 +149,11 @@ func Main() {
 			log.Fatalf("读取现有数据失败: %v", err)
 		}
 
-		maxProjectID := 0
-		for _, item := range existingList {
-			if item.ProjectID > maxProjectID {
-				maxProjectID = item.ProjectID
-			}
-		}
+		changeLog := newChangeLog("DA")
+		existingList = mergeSubjects(existingList, newSubjects, changeLog)
+		changeLog.save()
 
-		for _, newSubj := range newSubjects {
-			found := false
-			for i := range existingList {
-				if existingList[i].OriginalID == newSubj.OriginalID {
-					updateExistingFields(&existingList[i], &newSubj)
-					found = true
-					break
-				}
-			}
-
-			if !found {
-				maxProjectID++
-				newSubj.ProjectID = maxProjectID
-				existingList = append(existingList, newSubj)
-			}
-		}
-
-		output, err := json.MarshalIndent(existingList, "", "  ")
-		if err != nil {
-			log.Fatalf("JSON生成失败: %v", err)
-		}
-		if err := os.WriteFile("data/anime.json", output, 0644); err != nil {
+		if err := saveSubjects(existingList); err != nil {
 			log.Fatalf("文件写入失败: %v", err)
 		}
 		fmt.Printf("日期范围更新成功！现有条目数: %d\n", len(existingList))
@@ -157,15 +169,15 @@ func Main() {
 
 	case "CS", "CREATE_STAFF":
 		// 下载Person数据
-		fmt.Print("请输入下载Staff的动画ID列表（例如：1,2,5-10,12）: ")
+		fmt.Print("请输入下载Staff的动画ID列表（例如：1,2,5-10,12,!7 或 index:目录ID、@ids.txt、subjects-missing-staff）: ")
 		idInput, _ := reader.ReadString('\n')
 		idInput = strings.TrimSpace(idInput)
 
-		ids, err := ParseIDList(idInput)
+		expr, err := ParseIDExpr(idInput, ScopeSubject)
 		if err != nil {
 			log.Fatalf("ID列表解析失败: %v", err)
 		}
-		createSubjectPerson(ids, token)
+		createSubjectPerson(expr.All(), token)
 
 	case "AS", "ALL_STAFF":
 		// 根据Anime Lite下载Person数据
@@ -178,30 +190,30 @@ func Main() {
 		for _, item := range existingList {
 			ids = append(ids, item.OriginalID)
 		}
-		createSubjectPerson(ids, token)
+		createSubjectPerson(slices.Values(ids), token)
 
 	case "US", "UPDATE_STAFF":
 		// 更新Person数据
-		fmt.Print("请输入ID列表（例如：1,2,5-10,12）: ")
+		fmt.Print("请输入ID列表（例如：1,2,5-10,12,!7 或 index:目录ID、@ids.txt、subjects-missing-staff）: ")
 		idInput, _ := reader.ReadString('\n')
 		idInput = strings.TrimSpace(idInput)
 
-		ids, err := ParseIDList(idInput)
+		expr, err := ParseIDExpr(idInput, ScopeSubject)
 		if err != nil {
 			log.Fatalf("ID列表解析失败: %v", err)
 		}
-		updateSubjectPerson(ids, token)
+		updateSubjectPerson(expr.All(), token)
 
 	case "CR", "CREATE_RELATION":
-		fmt.Print("请输入ID列表（例如：1,2,5-10,12）: ")
+		fmt.Print("请输入ID列表（例如：1,2,5-10,12,!7 或 index:目录ID、@ids.txt、subjects-missing-staff）: ")
 		idInput, _ := reader.ReadString('\n')
 		idInput = strings.TrimSpace(idInput)
 
-		ids, err := ParseIDList(idInput)
+		expr, err := ParseIDExpr(idInput, ScopeSubject)
 		if err != nil {
 			log.Fatalf("ID列表解析失败: %v", err)
 		}
-		createSubjectRelations(ids, token)
+		createSubjectRelations(expr.All(), token)
 	case "AR", "ALL_RELATIONS":
 		existingList, err := readExistingSubjects()
 		if err != nil {
@@ -212,17 +224,66 @@ func Main() {
 		for _, item := range existingList {
 			ids = append(ids, item.OriginalID)
 		}
-		createSubjectRelations(ids, token)
+		createSubjectRelations(slices.Values(ids), token)
 	case "UR", "UPDATE_RELATION":
-		fmt.Print("请输入ID列表（例如：1,2,5-10,12）: ")
+		fmt.Print("请输入ID列表（例如：1,2,5-10,12,!7 或 index:目录ID、@ids.txt、subjects-missing-staff）: ")
 		idInput, _ := reader.ReadString('\n')
 		idInput = strings.TrimSpace(idInput)
 
-		ids, err := ParseIDList(idInput)
+		expr, err := ParseIDExpr(idInput, ScopeSubject)
 		if err != nil {
 			log.Fatalf("ID列表解析失败: %v", err)
 		}
-		updateSubjectRelations(ids, token)
+		updateSubjectRelations(expr.All(), token)
+
+	case "IA", "IMPORT_ARCHIVE":
+		fmt.Print("请输入Archive压缩包路径（例如：dump.zip）: ")
+		pathInput, _ := reader.ReadString('\n')
+		importArchive(strings.TrimSpace(pathInput))
+
+	case "SA", "SEARCH", "SEARCH_ANIME":
+		req, err := readSearchRequest(reader)
+		if err != nil {
+			log.Fatalf("搜索条件解析失败: %v", err)
+		}
+
+		fmt.Println("开始搜索条目...")
+		ids, err := fetchBySearch(req, token)
+		if err != nil {
+			log.Fatalf("搜索失败: %v", err)
+		}
+		fmt.Printf("搜索到 %d 个条目\n", len(ids))
+		if len(ids) == 0 {
+			return
+		}
+
+		// 已有数据时合并，否则直接创建
+		if _, err := readExistingSubjects(); err == nil {
+			updateMode(slices.Values(ids), token)
+		} else {
+			createMode(slices.Values(ids), token)
+		}
+		existingList, err := readExistingSubjects()
+		if err != nil {
+			log.Fatalf("读取现有数据失败: %v", err)
+		}
+		updateRemap(existingList)
+
+	case "CAL", "CALENDAR":
+		calendarMode(token)
+		existingList, err := readExistingSubjects()
+		if err != nil {
+			log.Fatalf("读取现有数据失败: %v", err)
+		}
+		updateRemap(existingList)
+
+	case "NA", "DISCOVER_NEW":
+		discoverNewMode(token)
+		existingList, err := readExistingSubjects()
+		if err != nil {
+			log.Fatalf("读取现有数据失败: %v", err)
+		}
+		updateRemap(existingList)
 
 	default:
 		println("无效模式选择，请选择以下选项：\n%s", tips)
@@ -1,16 +1,17 @@
 package subject
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"iter"
 	"log"
-	"os"
 	"sort"
+	"time"
+
+	. "bgm-catch/internal/basic"
 )
 
-func createMode(ids []int, token string) {
-	subjects := fetchByIdList(ids, token)
+func createMode(ids iter.Seq[int], token string) {
+	subjects, _ := fetchByIdSeq(ids, token, false)
 	projectID := 1
 
 	for i := range subjects {
@@ -18,67 +19,55 @@ func createMode(ids []int, token string) {
 		projectID++
 	}
 
-	if err := os.MkdirAll("data", os.ModePerm); err != nil {
-		log.Fatalf("创建data目录失败: %v", err)
-	}
-	output, err := json.MarshalIndent(subjects, "", "  ")
-	if err != nil {
-		log.Fatalf("JSON生成失败: %v", err)
-	}
-	if err := os.WriteFile("data/anime.json", output, 0644); err != nil {
+	if err := saveSubjects(subjects); err != nil {
 		log.Fatalf("文件写入失败: %v", err)
 	}
 	fmt.Printf("创建成功！共处理 %d 个条目\n", len(subjects))
 }
 
-func updateMode(ids []int, token string) {
-	fileData, err := ioutil.ReadFile("data/anime.json")
-	if err != nil {
-		log.Fatalf("读取现有文件失败: %v", err)
-	}
-
-	var existingList []JsonSubject
-	if err := json.Unmarshal(fileData, &existingList); err != nil {
-		log.Fatalf("JSON解析失败: %v", err)
-	}
-
-	maxProjectID := 0
-	for _, item := range existingList {
-		if item.ProjectID > maxProjectID {
-			maxProjectID = item.ProjectID
-		}
-	}
-
-	newSubjects := fetchByIdList(ids, token)
+func updateMode(ids iter.Seq[int], token string) {
+	updateModeWithin(ids, token, time.Time{})
+}
 
-	for _, newSubj := range newSubjects {
-		found := false
-		for i := range existingList {
-			if existingList[i].OriginalID == newSubj.OriginalID {
-				updateExistingFields(&existingList[i], &newSubj)
-				found = true
+// deadline 不为零时，到达截止时间后不再开始新的批次，已抓取的部分照常合并
+func updateModeWithin(ids iter.Seq[int], token string, deadline time.Time) {
+	existingList, err := readExistingSubjects()
+	if err != nil {
+		log.Fatalf("读取现有数据失败: %v", err)
+	}
+
+	var (
+		newSubjects []JsonSubject
+		missing     []MissingSubject
+	)
+	if deadline.IsZero() {
+		newSubjects, missing = fetchByIdSeq(ids, token, false)
+	} else {
+		fetched := 0
+		for chunk := range Chunk(ids, 200) {
+			if time.Now().After(deadline) {
+				log.Printf("已到达时间预算，已处理 %d 个条目，其余留待下次刷新", fetched)
 				break
 			}
-		}
-
-		if !found {
-			maxProjectID++
-			newSubj.ProjectID = maxProjectID
-			existingList = append(existingList, newSubj)
+			chunkSubjects, chunkMissing := fetchByIdList(chunk, token, false)
+			newSubjects = append(newSubjects, chunkSubjects...)
+			missing = append(missing, chunkMissing...)
+			fetched += len(chunk)
 		}
 	}
 
-	output, err := json.MarshalIndent(existingList, "", "  ")
-	if err != nil {
-		log.Fatalf("JSON生成失败: %v", err)
-	}
-	if err := os.WriteFile("data/anime.json", output, 0644); err != nil {
+	changeLog := newChangeLog("UA")
+	existingList = mergeSubjects(existingList, newSubjects, changeLog)
+	existingList = applyMissingPolicies(existingList, missing, changeLog)
+	changeLog.save()
+
+	if err := saveSubjects(existingList); err != nil {
 		log.Fatalf("文件写入失败: %v", err)
 	}
 	fmt.Printf("更新成功！现有条目数: %d\n", len(existingList))
 }
 
-func createSubjectPerson(ids []int, token string) {
+func createSubjectPerson(ids iter.Seq[int], token string) {
 	// Read existing data
 	existingList, err := readExistingSubjects()
 	if err != nil {
@@ -92,7 +81,7 @@ func createSubjectPerson(ids []int, token string) {
 	}
 
 	// Fetch subject persons by ID list
-	subjectPersons := fetchPersonsByIdList(ids, token)
+	subjectPersons := fetchPersonsByIdSeq(ids, token)
 
 	// Check if all IDs have corresponding project IDs
 	for i := range subjectPersons {
@@ -103,32 +92,18 @@ func createSubjectPerson(ids []int, token string) {
 		}
 	}
 
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll("data", os.ModePerm); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
-	}
-
-	// Save the subject persons data to a JSON file
-	output, err := json.MarshalIndent(subjectPersons, "", "  ")
-	if err != nil {
-		log.Fatalf("Failed to generate JSON: %v", err)
-	}
-	if err := os.WriteFile("data/anime_staffs.json", output, 0644); err != nil {
+	// Save the subject persons data
+	if err := saveStaffs(subjectPersons); err != nil {
 		log.Fatalf("Failed to write file: %v", err)
 	}
 	fmt.Printf("Creation successful! Processed %d entries\n", len(subjectPersons))
 }
 
-func updateSubjectPerson(ids []int, token string) {
+func updateSubjectPerson(ids iter.Seq[int], token string) {
 	// Read existing data
-	fileData, err := ioutil.ReadFile("data/anime_staffs.json")
+	existingList, err := readExistingStaffs()
 	if err != nil {
-		log.Fatalf("Failed to read existing file: %v", err)
-	}
-
-	var existingList []JsonSubjectPersonCollection
-	if err := json.Unmarshal(fileData, &existingList); err != nil {
-		log.Fatalf("Failed to parse JSON: %v", err)
+		log.Fatalf("Failed to read existing data: %v", err)
 	}
 
 	// Create a map for quick lookup of existing IDs
@@ -138,23 +113,24 @@ func updateSubjectPerson(ids []int, token string) {
 	}
 
 	// Fetch subject persons by ID list
-	newSubjectPersons := fetchPersonsByIdList(ids, token)
+	newSubjectPersons := fetchPersonsByIdSeq(ids, token)
 
 	// Update existing entries or add new ones
+	changeLog := newChangeLog("US")
+	names := subjectNames()
 	for _, newSP := range newSubjectPersons {
 		if existingSP, exists := existingIDMap[newSP.OriginalID]; exists {
+			changeLog.addChanges("staff", newSP.OriginalID, existingSP.ProjectID, names[newSP.OriginalID], diffStaffs(existingSP, &newSP))
 			*existingSP = newSP // Update existing entry
 		} else {
+			changeLog.addNew("staff", newSP.OriginalID, newSP.ProjectID, names[newSP.OriginalID])
 			existingList = append(existingList, newSP) // Add new entry
 		}
 	}
+	changeLog.save()
 
-	// Save the updated subject persons data to a JSON file
-	output, err := json.MarshalIndent(existingList, "", "  ")
-	if err != nil {
-		log.Fatalf("Failed to generate JSON: %v", err)
-	}
-	if err := os.WriteFile("data/anime_staffs.json", output, 0644); err != nil {
+	// Save the updated subject persons data
+	if err := saveStaffs(existingList); err != nil {
 		log.Fatalf("Failed to write file: %v", err)
 	}
 	fmt.Printf("Update successful! Total entries: %d\n", len(existingList))
@@ -177,40 +153,29 @@ func fixProjectIDs() {
 		idMap[existingSubjectsList[i].OriginalID] = existingSubjectsList[i].ProjectID
 	}
 
-	// 写回anime.json
-	output, _ := json.MarshalIndent(existingSubjectsList, "", "  ")
-	if err := os.WriteFile("data/anime.json", output, 0644); err != nil {
+	// 写回条目数据
+	if err := saveSubjects(existingSubjectsList); err != nil {
 		log.Fatalf("更新基础数据失败: %v", err)
 	}
 
 	// 处理staff数据
-	if _, err := os.Stat("data/anime_staffs.json"); err == nil {
-		fileData, _ := ioutil.ReadFile("data/anime_staffs.json")
-		var staffs []JsonSubjectPersonCollection
-		json.Unmarshal(fileData, &staffs)
-
+	if staffs, err := readExistingStaffs(); err == nil {
 		for i := range staffs {
 			if projectID, exists := idMap[staffs[i].OriginalID]; exists {
 				staffs[i].ProjectID = projectID
 			}
 		}
-		output, _ := json.MarshalIndent(staffs, "", "  ")
-		os.WriteFile("data/anime_staffs.json", output, 0644)
+		saveStaffs(staffs)
 	}
 
 	// 处理relation数据
-	if _, err := os.Stat("data/anime_relations.json"); err == nil {
-		fileData, _ := ioutil.ReadFile("data/anime_relations.json")
-		var relations []JsonSubjectRelationCollection
-		json.Unmarshal(fileData, &relations)
-
+	if relations, err := readExistingRelations(); err == nil {
 		for i := range relations {
 			if projectID, exists := idMap[relations[i].OriginalID]; exists {
 				relations[i].ProjectID = projectID
 			}
 		}
-		output, _ := json.MarshalIndent(relations, "", "  ")
-		os.WriteFile("data/anime_relations.json", output, 0644)
+		saveRelations(relations)
 	}
 
 	fmt.Printf("重新映射完成！总条目数: %d\n", len(existingSubjectsList))
@@ -218,7 +183,7 @@ func fixProjectIDs() {
 }
 
 // 新增创建关系数据函数
-func createSubjectRelations(ids []int, token string) {
+func createSubjectRelations(ids iter.Seq[int], token string) {
 	existingList, err := readExistingSubjects()
 	if err != nil {
 		log.Fatalf("读取基础数据失败: %v", err)
@@ -229,7 +194,7 @@ func createSubjectRelations(ids []int, token string) {
 		existingIDMap[item.OriginalID] = item.ProjectID
 	}
 
-	subjectRelations := fetchRelationsByIdList(ids, token)
+	subjectRelations := fetchRelationsByIdSeq(ids, token)
 
 	for i := range subjectRelations {
 		if projectID, exists := existingIDMap[subjectRelations[i].OriginalID]; exists {
@@ -239,47 +204,39 @@ func createSubjectRelations(ids []int, token string) {
 		}
 	}
 
-	output, err := json.MarshalIndent(subjectRelations, "", "  ")
-	if err != nil {
-		log.Fatalf("JSON生成失败: %v", err)
-	}
-	if err := os.WriteFile("data/anime_relations.json", output, 0644); err != nil {
+	if err := saveRelations(subjectRelations); err != nil {
 		log.Fatalf("文件写入失败: %v", err)
 	}
 	fmt.Printf("关系数据创建成功！共处理 %d 个条目\n", len(subjectRelations))
 }
 
-func updateSubjectRelations(ids []int, token string) {
-	fileData, err := ioutil.ReadFile("data/anime_relations.json")
+func updateSubjectRelations(ids iter.Seq[int], token string) {
+	existingList, err := readExistingRelations()
 	if err != nil {
 		log.Fatalf("读取关系数据失败: %v", err)
 	}
 
-	var existingList []JsonSubjectRelationCollection
-	if err := json.Unmarshal(fileData, &existingList); err != nil {
-		log.Fatalf("JSON解析失败: %v", err)
-	}
-
 	existingIDMap := make(map[int]*JsonSubjectRelationCollection)
 	for i := range existingList {
 		existingIDMap[existingList[i].OriginalID] = &existingList[i]
 	}
 
-	newRelations := fetchRelationsByIdList(ids, token)
+	newRelations := fetchRelationsByIdSeq(ids, token)
 
+	changeLog := newChangeLog("UR")
+	names := subjectNames()
 	for _, newRel := range newRelations {
 		if existingRel, exists := existingIDMap[newRel.OriginalID]; exists {
+			changeLog.addChanges("relation", newRel.OriginalID, existingRel.ProjectID, names[newRel.OriginalID], diffRelations(existingRel, &newRel))
 			*existingRel = newRel
 		} else {
+			changeLog.addNew("relation", newRel.OriginalID, newRel.ProjectID, names[newRel.OriginalID])
 			existingList = append(existingList, newRel)
 		}
 	}
+	changeLog.save()
 
-	output, err := json.MarshalIndent(existingList, "", "  ")
-	if err != nil {
-		log.Fatalf("JSON生成失败: %v", err)
-	}
-	if err := os.WriteFile("data/anime_relations.json", output, 0644); err != nil {
+	if err := saveRelations(existingList); err != nil {
 		log.Fatalf("文件写入失败: %v", err)
 	}
 	fmt.Printf("关系数据更新成功！现有条目数: %d\n", len(existingList))
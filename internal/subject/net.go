@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"github.com/gocolly/colly/v2"
 	"github.com/schollz/progressbar/v3"
+	"iter"
 	"log"
 	"runtime"
 	"sync"
 	"time"
+
+	. "bgm-catch/internal/basic"
 )
 
 // 按日期范围抓取数据
@@ -118,7 +121,9 @@ func fetchByDateRange(dates []struct{ Year, Month int }, token string) []JsonSub
 
 // ------------------------- 数据抓取逻辑 -------------------------
 
-func fetchByIdList(ids []int, token string) []JsonSubject {
+// 返回符合条件的条目，以及被删除、合并或不再满足条件的条目
+// allowUnranked 为 true 时保留尚无排名的动画（如正在放送的新番）
+func fetchByIdList(ids []int, token string, allowUnranked bool) ([]JsonSubject, []MissingSubject) {
 
 	numCPU := runtime.NumCPU()
 	log.Printf("使用 %d 线程", numCPU)
@@ -128,6 +133,7 @@ func fetchByIdList(ids []int, token string) []JsonSubject {
 		logMutex sync.Mutex
 		sem      = make(chan struct{}, numCPU)
 		results  = make(chan JsonSubject, len(ids))
+		missing  = make(chan MissingSubject, len(ids))
 		bar      = progressbar.Default(int64(len(ids)))
 	)
 
@@ -158,18 +164,27 @@ func fetchByIdList(ids []int, token string) []JsonSubject {
 
 				if subject.OriginalID != id {
 					logMutex.Lock()
-					log.Printf("ID %d 不存在", id)
+					log.Printf("ID %d 已被合并到 %d", id, subject.OriginalID)
 					logMutex.Unlock()
+					missing <- MissingSubject{OriginalID: id, Reason: missingMerged, MergedInto: subject.OriginalID}
+					// 合并目标满足条件时一并收录，便于重定向
+					if subject.Type == 2 && (subject.Rating.Rank != 0 || allowUnranked) {
+						subject.FetchedAt = time.Now().Format("2006-01-02 15:04:05")
+						results <- subject
+					}
 					return
 				}
 
-				if subject.Type != 2 || subject.Rating.Rank == 0 {
+				if subject.Type != 2 || (subject.Rating.Rank == 0 && !allowUnranked) {
 					logMutex.Lock()
 					log.Printf("ID %d 不符合条件（类型：%d，排名：%d）", id, subject.Type, subject.Rating.Rank)
 					logMutex.Unlock()
+					missing <- MissingSubject{OriginalID: id, Reason: missingFiltered,
+						Detail: fmt.Sprintf("类型：%d，排名：%d", subject.Type, subject.Rating.Rank)}
 					return
 				}
 
+				subject.FetchedAt = time.Now().Format("2006-01-02 15:04:05")
 				results <- subject
 				bar.Add(1)
 			})
@@ -178,22 +193,34 @@ func fetchByIdList(ids []int, token string) []JsonSubject {
 				logMutex.Lock()
 				log.Printf("请求错误（ID %d）: %v", id, err)
 				logMutex.Unlock()
+				if r != nil && r.StatusCode == 404 {
+					missing <- MissingSubject{OriginalID: id, Reason: missingNotFound, Detail: err.Error()}
+				}
 			})
 
 			c.Visit(url)
 		}(id)
 	}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	wg.Wait()
+	close(results)
+	close(missing)
 
+	// 合并目标可能与请求列表中的ID重复，需去重
+	seen := make(map[int]struct{})
 	var subjects []JsonSubject
 	for subj := range results {
+		if _, exists := seen[subj.OriginalID]; exists {
+			continue
+		}
+		seen[subj.OriginalID] = struct{}{}
 		subjects = append(subjects, subj)
 	}
-	return subjects
+	var missingList []MissingSubject
+	for m := range missing {
+		missingList = append(missingList, m)
+	}
+	return subjects, missingList
 }
 
 func fetchPersonsByIdList(ids []int, token string) []JsonSubjectPersonCollection {
@@ -331,3 +358,44 @@ func fetchRelationsByIdList(ids []int, token string) []JsonSubjectRelationCollec
 	}
 	return relationCollections
 }
+
+// ------------------------- 分批抓取 -------------------------
+// ID表达式可能包含很大的范围，按批次展开和抓取，不一次性生成全部ID和请求
+
+const fetchChunkSize = 500
+
+func fetchByIdSeq(ids iter.Seq[int], token string, allowUnranked bool) ([]JsonSubject, []MissingSubject) {
+	var (
+		subjects []JsonSubject
+		missing  []MissingSubject
+		seen     = make(map[int]struct{})
+	)
+	for chunk := range Chunk(ids, fetchChunkSize) {
+		chunkSubjects, chunkMissing := fetchByIdList(chunk, token, allowUnranked)
+		// 合并目标可能出现在不同批次中
+		for _, subj := range chunkSubjects {
+			if _, exists := seen[subj.OriginalID]; !exists {
+				seen[subj.OriginalID] = struct{}{}
+				subjects = append(subjects, subj)
+			}
+		}
+		missing = append(missing, chunkMissing...)
+	}
+	return subjects, missing
+}
+
+func fetchPersonsByIdSeq(ids iter.Seq[int], token string) []JsonSubjectPersonCollection {
+	var collections []JsonSubjectPersonCollection
+	for chunk := range Chunk(ids, fetchChunkSize) {
+		collections = append(collections, fetchPersonsByIdList(chunk, token)...)
+	}
+	return collections
+}
+
+func fetchRelationsByIdSeq(ids iter.Seq[int], token string) []JsonSubjectRelationCollection {
+	var collections []JsonSubjectRelationCollection
+	for chunk := range Chunk(ids, fetchChunkSize) {
+		collections = append(collections, fetchRelationsByIdList(chunk, token)...)
+	}
+	return collections
+}
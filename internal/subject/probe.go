@@ -0,0 +1,172 @@
+package subject
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly/v2"
+	"log"
+	"os"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 新条目探测 -------------------------
+
+// 探测进度，记录上次探测到的最大存在ID
+type probeState struct {
+	HighWater int    `json:"high_water"`
+	LastRun   string `json:"last_run"`
+}
+
+const (
+	probeExists   = iota // 条目存在
+	probeNotFound        // 404
+	probeFailed          // 其他错误，不计入连续404
+)
+
+// 从已知最大ID开始向后探测新建条目，符合条件的动画合并进数据集
+func discoverNewMode(token string) {
+	existingList, err := readExistingSubjects()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("读取现有数据失败: %v", err)
+	}
+
+	state := readProbeState()
+	start := state.HighWater
+	for _, item := range existingList {
+		if item.OriginalID > start {
+			start = item.OriginalID
+		}
+	}
+	start++
+	fmt.Printf("从ID %d 开始探测（连续 %d 次404后停止）\n", start, probeMaxMisses)
+
+	var (
+		found      []JsonSubject
+		highWater  = start - 1
+		misses     = 0
+		failures   = 0 // 连续请求失败次数，接口故障或限流时据此中止
+		step       = 1
+		lastProbed = start - 1
+		probed     = 0
+	)
+	check := func(id int) bool {
+		probed++
+		subject, result := probeSubject(id, token)
+		switch result {
+		case probeExists:
+			failures = 0
+			if id > highWater {
+				highWater = id
+			}
+			if subject.Type == 2 && subject.Rating.Rank != 0 {
+				found = append(found, subject)
+			}
+			return true
+		case probeNotFound:
+			failures = 0
+			misses++
+		case probeFailed:
+			failures++
+		}
+		return false
+	}
+
+	for cursor := start; misses < probeMaxMisses && failures < probeMaxMisses; cursor += step {
+		if !check(cursor) {
+			// 连续404时逐步扩大步长，跳过大段空号
+			if misses > 0 && misses%5 == 0 && step < probeMaxStep {
+				step *= 2
+			}
+			lastProbed = cursor
+			continue
+		}
+
+		// 跳跃时发现存在的条目，回填被跳过的ID
+		for id := lastProbed + 1; id < cursor && failures < probeMaxMisses; id++ {
+			check(id)
+		}
+		misses = 0
+		step = 1
+		lastProbed = cursor
+	}
+
+	if failures >= probeMaxMisses {
+		log.Printf("连续 %d 次请求失败（接口故障或限流），中止探测，不保存本次结果和探测状态", failures)
+		return
+	}
+
+	fmt.Printf("探测结束：共探测 %d 个ID，最大存在ID %d，符合条件的动画 %d 个\n", probed, highWater, len(found))
+	log.Printf("新条目探测：起始ID %d，最大存在ID %d，探测次数 %d，符合条件 %d", start, highWater, probed, len(found))
+
+	if len(found) > 0 {
+		changeLog := newChangeLog("NA")
+		existingList = mergeSubjects(existingList, found, changeLog)
+		changeLog.save()
+
+		if err := os.MkdirAll(DataRoot(), os.ModePerm); err != nil {
+			log.Fatalf("创建data目录失败: %v", err)
+		}
+		if err := saveSubjects(existingList); err != nil {
+			log.Fatalf("文件写入失败: %v", err)
+		}
+	}
+
+	state.HighWater = highWater
+	state.LastRun = time.Now().Format("2006-01-02 15:04:05")
+	writeJSONFile(probeStateFile(), state)
+}
+
+func readProbeState() probeState {
+	var state probeState
+	data, err := os.ReadFile(probeStateFile())
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("探测状态解析失败: %v", err)
+	}
+	return state
+}
+
+// 请求单个条目并区分存在、404与其他错误
+func probeSubject(id int, token string) (JsonSubject, int) {
+	var (
+		subject JsonSubject
+		result  = probeFailed
+	)
+	url := fmt.Sprintf("https://api.bgm.tv/v0/subjects/%d", id)
+
+	for attempt := 0; attempt < 3 && result == probeFailed; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		c := colly.NewCollector()
+		c.SetRequestTimeout(60 * time.Second)
+		if token != "" {
+			c.OnRequest(func(r *colly.Request) {
+				r.Headers.Set("Authorization", "Bearer "+token)
+			})
+		}
+		c.OnResponse(func(r *colly.Response) {
+			if err := json.Unmarshal(r.Body, &subject); err != nil {
+				log.Printf("解析JSON失败（ID %d）: %v", id, err)
+				return
+			}
+			subject.FetchedAt = time.Now().Format("2006-01-02 15:04:05")
+			result = probeExists
+		})
+		c.OnError(func(r *colly.Response, err error) {
+			if r != nil && r.StatusCode == 404 {
+				result = probeNotFound
+				return
+			}
+			log.Printf("请求错误（ID %d）: %v", id, err)
+		})
+		c.Visit(url)
+		c.Wait()
+	}
+	return subject, result
+}
@@ -1,5 +1,13 @@
 package subject
 
+import (
+	"log"
+	"slices"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
 func updateExistingFields(existing *JsonSubject, newData *JsonSubject) {
 	existing.Collection = newData.Collection
 	existing.Date = newData.Date
@@ -19,4 +27,159 @@ func updateExistingFields(existing *JsonSubject, newData *JsonSubject) {
 	existing.TotalEpisodes = newData.TotalEpisodes
 	existing.Type = newData.Type
 	existing.Volumes = newData.Volumes
+	existing.Status = newData.Status
+	existing.MergedInto = newData.MergedInto
+	existing.FetchedAt = newData.FetchedAt
+}
+
+// 将新抓取的条目合并进现有列表：已有条目更新字段并保留project_id，新条目追加并分配新的project_id
+func mergeSubjects(existingList []JsonSubject, newSubjects []JsonSubject, changeLog *ChangeLog) []JsonSubject {
+	maxProjectID := 0
+	indexByID := make(map[int]int, len(existingList))
+	for i, item := range existingList {
+		if item.ProjectID > maxProjectID {
+			maxProjectID = item.ProjectID
+		}
+		indexByID[item.OriginalID] = i
+	}
+
+	for _, newSubj := range newSubjects {
+		if i, found := indexByID[newSubj.OriginalID]; found {
+			changeLog.addChanges("subject", newSubj.OriginalID, existingList[i].ProjectID, newSubj.Name,
+				diffSubject(&existingList[i], &newSubj))
+			updateExistingFields(&existingList[i], &newSubj)
+			continue
+		}
+
+		maxProjectID++
+		newSubj.ProjectID = maxProjectID
+		indexByID[newSubj.OriginalID] = len(existingList)
+		existingList = append(existingList, newSubj)
+		changeLog.addNew("subject", newSubj.OriginalID, newSubj.ProjectID, newSubj.Name)
+	}
+	return existingList
+}
+
+// 按配置的策略处理被删除、合并或不再满足条件的条目
+func applyMissingPolicies(existingList []JsonSubject, missing []MissingSubject, changeLog *ChangeLog) []JsonSubject {
+	if len(missing) == 0 {
+		return existingList
+	}
+
+	indexByID := make(map[int]int, len(existingList))
+	for i, item := range existingList {
+		indexByID[item.OriginalID] = i
+	}
+
+	redirects, err := readRedirects()
+	if err != nil {
+		log.Printf("读取重定向表失败: %v", err)
+		redirects = make(map[int]int)
+	}
+
+	removed := make(map[int]struct{})
+	counts := make(map[string]int)
+	for _, m := range missing {
+		i, exists := indexByID[m.OriginalID]
+		if !exists {
+			continue // 不在现有数据中，无需处理
+		}
+		existing := &existingList[i]
+		if m.Reason == missingFiltered && existing.OnAir {
+			continue // 放送中的新番尚无排名，由日历模式维护
+		}
+		policy := missingPolicies[m.Reason]
+
+		// 合并目标不在数据集中时无法重定向，退化为墓碑
+		if policy == policyRedirect {
+			if _, targetExists := indexByID[m.MergedInto]; m.Reason != missingMerged || !targetExists {
+				log.Printf("ID %d 无法重定向（%s），改为标记墓碑", m.OriginalID, m.Reason)
+				policy = policyTombstone
+			}
+		}
+
+		switch policy {
+		case policyTombstone:
+			if existing.Status == m.Reason && existing.MergedInto == m.MergedInto {
+				continue
+			}
+			changeLog.addChanges("subject", existing.OriginalID, existing.ProjectID, existing.Name,
+				[]FieldChange{{Field: "status", Old: existing.Status, New: m.Reason}})
+			existing.Status = m.Reason
+			existing.MergedInto = m.MergedInto
+		case policyRedirect:
+			changeLog.addChanges("subject", existing.OriginalID, existing.ProjectID, existing.Name,
+				[]FieldChange{{Field: "redirect", Old: existing.OriginalID, New: m.MergedInto}})
+			redirects[m.OriginalID] = m.MergedInto
+			removed[m.OriginalID] = struct{}{}
+		default:
+			continue
+		}
+		counts[m.Reason+"/"+policy]++
+	}
+
+	for key, count := range counts {
+		log.Printf("缺失条目处理 %s: %d", key, count)
+	}
+
+	if len(removed) == 0 {
+		return existingList
+	}
+	if err := saveRedirects(redirects); err != nil {
+		log.Printf("保存重定向表失败: %v", err)
+	}
+	pruneSubjectData(removed)
+	log.Printf("已移除 %d 个重定向条目，其 project_id 留空，可运行 R 模式重新编号", len(removed))
+	kept := existingList[:0]
+	for _, item := range existingList {
+		if _, isRemoved := removed[item.OriginalID]; !isRemoved {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// 删除已移除条目的Staff和关系数据，避免留下没有对应条目的记录；数据文件不存在时跳过
+func pruneSubjectData(removed map[int]struct{}) {
+	isRemoved := func(id int) bool {
+		_, exists := removed[id]
+		return exists
+	}
+	if staffs, err := readExistingStaffs(); err == nil {
+		count := len(staffs)
+		staffs = slices.DeleteFunc(staffs, func(s JsonSubjectPersonCollection) bool { return isRemoved(s.OriginalID) })
+		if len(staffs) < count {
+			if err := saveStaffs(staffs); err != nil {
+				log.Printf("更新Staff数据失败: %v", err)
+			}
+		}
+	}
+	if relations, err := readExistingRelations(); err == nil {
+		count := len(relations)
+		relations = slices.DeleteFunc(relations, func(r JsonSubjectRelationCollection) bool { return isRemoved(r.OriginalID) })
+		if len(relations) < count {
+			if err := saveRelations(relations); err != nil {
+				log.Printf("更新关系数据失败: %v", err)
+			}
+		}
+	}
+}
+
+// 按获取时间规划需要刷新的条目，放送中的条目视为活跃
+func planStaleSubjects(budget RefreshBudget) ([]int, int, error) {
+	var items []RefreshItem
+	err := currentStore().EachSubject(func(subject JsonSubject) error {
+		item := RefreshItem{ID: subject.OriginalID, Active: subject.OnAir, Cost: 1}
+		if fetchedAt, err := time.ParseInLocation("2006-01-02 15:04:05", subject.FetchedAt, time.Local); err == nil {
+			item.LastFetched = fetchedAt
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids, requests := PlanRefresh(items, budget, time.Now())
+	return ids, requests, nil
 }
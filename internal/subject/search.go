@@ -0,0 +1,176 @@
+package subject
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly/v2"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------- 搜索API条目发现 -------------------------
+
+type searchFilter struct {
+	Type    []int    `json:"type"`
+	Tag     []string `json:"tag,omitempty"`
+	AirDate []string `json:"air_date,omitempty"`
+	Rating  []string `json:"rating,omitempty"`
+	Rank    []string `json:"rank,omitempty"`
+	Nsfw    *bool    `json:"nsfw,omitempty"` // 为空时返回全部，true只返回R18，false只返回非R18
+}
+
+type searchRequest struct {
+	Keyword string       `json:"keyword"`
+	Sort    string       `json:"sort"`
+	Filter  searchFilter `json:"filter"`
+}
+
+type searchResponse struct {
+	Data []struct {
+		ID int `json:"id"`
+	} `json:"data"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// 交互式读取搜索条件
+func readSearchRequest(reader *bufio.Reader) (searchRequest, error) {
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		input, _ := reader.ReadString('\n')
+		return strings.TrimSpace(input)
+	}
+
+	req := searchRequest{
+		Sort:   "rank",
+		Filter: searchFilter{Type: []int{2}},
+	}
+	req.Keyword = ask("请输入关键词（可留空）: ")
+
+	if tags := ask("请输入标签，多个用逗号分隔（可留空）: "); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				req.Filter.Tag = append(req.Filter.Tag, tag)
+			}
+		}
+	}
+
+	startDate := ask("请输入放送起始日期（格式：YYYY-MM-DD，可留空）: ")
+	endDate := ask("请输入放送结束日期（格式：YYYY-MM-DD，可留空）: ")
+	for _, d := range []struct{ value, op string }{{startDate, ">="}, {endDate, "<="}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d.value); err != nil {
+			return req, fmt.Errorf("无效的日期格式: %s", d.value)
+		}
+		req.Filter.AirDate = append(req.Filter.AirDate, d.op+d.value)
+	}
+
+	var err error
+	if req.Filter.Rank, err = parseNumberRange(ask("请输入排名范围（例如：1-1000，可留空）: ")); err != nil {
+		return req, fmt.Errorf("排名范围解析失败: %v", err)
+	}
+	if req.Filter.Rating, err = parseNumberRange(ask("请输入评分范围（例如：7-10，可留空）: ")); err != nil {
+		return req, fmt.Errorf("评分范围解析失败: %v", err)
+	}
+
+	switch strings.ToLower(ask("是否为R18条目（y=仅R18/n=排除R18/留空=不限）: ")) {
+	case "y", "yes":
+		nsfw := true
+		req.Filter.Nsfw = &nsfw
+	case "n", "no":
+		nsfw := false
+		req.Filter.Nsfw = &nsfw
+	}
+
+	if req.Keyword == "" && len(req.Filter.Tag) == 0 && len(req.Filter.AirDate) == 0 &&
+		len(req.Filter.Rank) == 0 && len(req.Filter.Rating) == 0 {
+		return req, fmt.Errorf("至少需要指定一个搜索条件")
+	}
+	return req, nil
+}
+
+// 将 "a-b" 形式的范围转换为搜索API的比较条件，任意一端可留空
+func parseNumberRange(input string) ([]string, error) {
+	if input == "" {
+		return nil, nil
+	}
+	low, high, found := strings.Cut(input, "-")
+	if !found {
+		high = low
+	}
+
+	var conditions []string
+	for _, bound := range []struct{ value, op string }{{low, ">="}, {high, "<="}} {
+		value := strings.TrimSpace(bound.value)
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("无效数值: %s", value)
+		}
+		conditions = append(conditions, bound.op+value)
+	}
+	return conditions, nil
+}
+
+// 分页获取搜索结果中的所有条目ID
+func fetchBySearch(req searchRequest, token string) ([]int, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	limit := 20
+	offset := 0
+	for {
+		var (
+			page    searchResponse
+			pageErr error
+		)
+		url := fmt.Sprintf("https://api.bgm.tv/v0/search/subjects?limit=%d&offset=%d", limit, offset)
+
+		c := colly.NewCollector()
+		c.SetRequestTimeout(60 * time.Second)
+		c.OnRequest(func(r *colly.Request) {
+			r.Headers.Set("Content-Type", "application/json")
+			if token != "" {
+				r.Headers.Set("Authorization", "Bearer "+token)
+			}
+		})
+		c.OnResponse(func(r *colly.Response) {
+			if err := json.Unmarshal(r.Body, &page); err != nil {
+				pageErr = fmt.Errorf("解析失败 offset %d: %v", offset, err)
+			}
+		})
+		c.OnError(func(r *colly.Response, err error) {
+			pageErr = fmt.Errorf("请求失败 offset %d: %v", offset, err)
+		})
+
+		if err := c.PostRaw(url, body); err != nil && pageErr == nil {
+			pageErr = err
+		}
+		c.Wait()
+		if pageErr != nil {
+			return ids, pageErr
+		}
+
+		for _, item := range page.Data {
+			ids = append(ids, item.ID)
+		}
+		log.Printf("搜索进度 %d/%d", len(ids), page.Total)
+
+		offset += limit
+		if len(page.Data) == 0 || offset >= page.Total {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return ids, nil
+}
@@ -0,0 +1,123 @@
+package subject
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- ID表达式选择器 -------------------------
+
+func init() {
+	RegisterSelector(ScopeSubject, "subjects-all", selectAllSubjects)
+	RegisterSelector(ScopeSubject, "subjects-missing-staff", selectSubjectsMissingStaff)
+	RegisterSelector(ScopeSubject, "subjects-missing-relations", selectSubjectsMissingRelations)
+	RegisterSelector(ScopeSubject, "subjects-stale", selectStaleSubjects)
+	RegisterSelector(ScopeSubject, "index", selectIndexSubjects)
+}
+
+// subjects-all：anime.json 中的全部条目
+func selectAllSubjects(op, arg string) ([]int, error) {
+	existingList, err := readExistingSubjects()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(existingList))
+	for _, item := range existingList {
+		ids = append(ids, item.OriginalID)
+	}
+	return ids, nil
+}
+
+// subjects-missing-staff：没有Staff数据的条目
+func selectSubjectsMissingStaff(op, arg string) ([]int, error) {
+	staffs, err := readExistingStaffs()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	has := make(map[int]bool, len(staffs))
+	for _, s := range staffs {
+		has[s.OriginalID] = len(s.JsonSubjectPersons) > 0
+	}
+	return selectSubjectsWhere(func(item JsonSubject) bool { return !has[item.OriginalID] })
+}
+
+// subjects-missing-relations：没有关系数据的条目
+func selectSubjectsMissingRelations(op, arg string) ([]int, error) {
+	relations, err := readExistingRelations()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	has := make(map[int]bool, len(relations))
+	for _, r := range relations {
+		has[r.OriginalID] = true
+	}
+	return selectSubjectsWhere(func(item JsonSubject) bool { return !has[item.OriginalID] })
+}
+
+// subjects-stale>30d：超过指定时长未获取的条目，没有获取时间的条目视为过期
+func selectStaleSubjects(op, arg string) ([]int, error) {
+	if op != ">" {
+		return nil, fmt.Errorf("用法: subjects-stale>30d")
+	}
+	age, err := ParseAge(arg)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-age)
+	return selectSubjectsWhere(func(item JsonSubject) bool {
+		fetchedAt, err := time.ParseInLocation("2006-01-02 15:04:05", item.FetchedAt, time.Local)
+		return err != nil || fetchedAt.Before(cutoff)
+	})
+}
+
+// index:12345：目录中的动画条目，index:all 表示所有已记录的目录
+func selectIndexSubjects(op, arg string) ([]int, error) {
+	if op != ":" || arg == "" {
+		return nil, fmt.Errorf("用法: index:目录ID 或 index:all")
+	}
+	token := os.Getenv("TOKEN")
+
+	var indexIDs []int
+	if strings.ToLower(arg) == "all" {
+		recorded, err := readRecordedIndexIDs()
+		if err != nil {
+			return nil, fmt.Errorf("读取已记录目录失败: %v", err)
+		}
+		indexIDs = recorded
+	} else {
+		indexID, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("无效目录ID: %s", arg)
+		}
+		indexIDs = []int{indexID}
+	}
+
+	var ids []int
+	for _, indexID := range indexIDs {
+		index, err := fetchIndex(indexID, token)
+		if err != nil {
+			return nil, fmt.Errorf("获取目录 %d 失败: %v", indexID, err)
+		}
+		ids = append(ids, index.Subjects...)
+	}
+	return ids, nil
+}
+
+func selectSubjectsWhere(match func(item JsonSubject) bool) ([]int, error) {
+	existingList, err := readExistingSubjects()
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, item := range existingList {
+		if match(item) {
+			ids = append(ids, item.OriginalID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,456 @@
+package subject
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- SQLite读写 -------------------------
+// 每次保存在一个事务中整体替换，读取时按 project_id 排序，与JSON文件的顺序一致
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func mustJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func readSubjectsDB() ([]JsonSubject, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(`SELECT id, project_id, type, name, name_cn, date, platform, summary, eps, total_episodes, volumes,
+		locked, nsfw, series, rating_rank, rating_score, rating_total, rating_count,
+		collect_wish, collect_collect, collect_doing, collect_on_hold, collect_dropped,
+		images, meta_tags, status, merged_into, on_air, air_weekday, fetched_at
+		FROM subjects ORDER BY project_id, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []JsonSubject
+	indexByID := make(map[int]int)
+	for rows.Next() {
+		var (
+			s                             JsonSubject
+			locked, nsfw, series, onAir   int
+			ratingCount, images, metaTags string
+		)
+		if err := rows.Scan(&s.OriginalID, &s.ProjectID, &s.Type, &s.Name, &s.NameCn, &s.Date, &s.Platform, &s.Summary,
+			&s.Eps, &s.TotalEpisodes, &s.Volumes, &locked, &nsfw, &series,
+			&s.Rating.Rank, &s.Rating.Score, &s.Rating.Total, &ratingCount,
+			&s.Collection.Wish, &s.Collection.Collect, &s.Collection.Doing, &s.Collection.OnHold, &s.Collection.Dropped,
+			&images, &metaTags, &s.Status, &s.MergedInto, &onAir, &s.AirWeekday, &s.FetchedAt); err != nil {
+			return nil, err
+		}
+		s.Locked, s.Nsfw, s.Series, s.OnAir = locked == 1, nsfw == 1, series == 1, onAir == 1
+		json.Unmarshal([]byte(ratingCount), &s.Rating.Count)
+		json.Unmarshal([]byte(images), &s.Images)
+		json.Unmarshal([]byte(metaTags), &s.MetaTags)
+		s.Tags = []FileTag{}
+		s.Infobox = []Infobox{}
+		indexByID[s.OriginalID] = len(list)
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, os.ErrNotExist // 与数据文件不存在时的行为一致
+	}
+
+	tagRows, err := conn.Query(`SELECT subject_id, name, count, total_cont FROM subject_tags ORDER BY subject_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var (
+			id  int
+			tag FileTag
+		)
+		if err := tagRows.Scan(&id, &tag.Name, &tag.Count, &tag.TotalCont); err != nil {
+			return nil, err
+		}
+		if i, exists := indexByID[id]; exists {
+			list[i].Tags = append(list[i].Tags, tag)
+		}
+	}
+
+	infoRows, err := conn.Query(`SELECT subject_id, key, value FROM subject_infobox ORDER BY subject_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer infoRows.Close()
+	for infoRows.Next() {
+		var (
+			id    int
+			item  Infobox
+			value string
+		)
+		if err := infoRows.Scan(&id, &item.Key, &value); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(value), &item.Value)
+		if i, exists := indexByID[id]; exists {
+			list[i].Infobox = append(list[i].Infobox, item)
+		}
+	}
+	return list, infoRows.Err()
+}
+
+func writeSubjectsDB(list []JsonSubject) error {
+	return WithTx(func(tx *sql.Tx) error {
+		for _, stmt := range []string{`DELETE FROM subject_tags`, `DELETE FROM subject_infobox`, `DELETE FROM subjects`} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+
+		insertSubject, err := tx.Prepare(`INSERT INTO subjects (id, project_id, type, name, name_cn, date, platform, summary,
+			eps, total_episodes, volumes, locked, nsfw, series, rating_rank, rating_score, rating_total, rating_count,
+			collect_wish, collect_collect, collect_doing, collect_on_hold, collect_dropped,
+			images, meta_tags, status, merged_into, on_air, air_weekday, fetched_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertSubject.Close()
+		insertTag, err := tx.Prepare(`INSERT INTO subject_tags (subject_id, position, name, count, total_cont) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertTag.Close()
+		insertInfo, err := tx.Prepare(`INSERT INTO subject_infobox (subject_id, position, key, value) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertInfo.Close()
+
+		for _, s := range list {
+			if _, err := insertSubject.Exec(s.OriginalID, s.ProjectID, s.Type, s.Name, s.NameCn, s.Date, s.Platform, s.Summary,
+				s.Eps, s.TotalEpisodes, s.Volumes, boolInt(s.Locked), boolInt(s.Nsfw), boolInt(s.Series),
+				s.Rating.Rank, s.Rating.Score, s.Rating.Total, mustJSON(s.Rating.Count),
+				s.Collection.Wish, s.Collection.Collect, s.Collection.Doing, s.Collection.OnHold, s.Collection.Dropped,
+				mustJSON(s.Images), mustJSON(s.MetaTags), s.Status, s.MergedInto, boolInt(s.OnAir), s.AirWeekday, s.FetchedAt); err != nil {
+				return fmt.Errorf("写入条目 %d 失败: %v", s.OriginalID, err)
+			}
+			for i, tag := range s.Tags {
+				if _, err := insertTag.Exec(s.OriginalID, i, tag.Name, tag.Count, tag.TotalCont); err != nil {
+					return err
+				}
+			}
+			for i, item := range s.Infobox {
+				if _, err := insertInfo.Exec(s.OriginalID, i, item.Key, mustJSON(item.Value)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func readStaffsDB() ([]JsonSubjectPersonCollection, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(`SELECT subject_id, project_id FROM subject_staff_sets ORDER BY project_id, subject_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var staffs []JsonSubjectPersonCollection
+	indexByID := make(map[int]int)
+	for rows.Next() {
+		collection := JsonSubjectPersonCollection{JsonSubjectPersons: []JsonSubjectPerson{}}
+		if err := rows.Scan(&collection.OriginalID, &collection.ProjectID); err != nil {
+			return nil, err
+		}
+		indexByID[collection.OriginalID] = len(staffs)
+		staffs = append(staffs, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(staffs) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	personRows, err := conn.Query(`SELECT sp.subject_id, sp.person_id, sp.relation, sp.eps, p.name, p.type, p.career, p.images
+		FROM subject_persons sp JOIN persons p ON p.id = sp.person_id ORDER BY sp.subject_id, sp.position`)
+	if err != nil {
+		return nil, err
+	}
+	defer personRows.Close()
+	for personRows.Next() {
+		var (
+			subjectID      int
+			person         JsonSubjectPerson
+			career, images string
+		)
+		if err := personRows.Scan(&subjectID, &person.ID, &person.Relation, &person.Eps, &person.Name, &person.Type, &career, &images); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(career), &person.Career)
+		json.Unmarshal([]byte(images), &person.Images)
+		if i, exists := indexByID[subjectID]; exists {
+			staffs[i].JsonSubjectPersons = append(staffs[i].JsonSubjectPersons, person)
+		}
+	}
+	return staffs, personRows.Err()
+}
+
+func writeStaffsDB(staffs []JsonSubjectPersonCollection) error {
+	return WithTx(func(tx *sql.Tx) error {
+		for _, stmt := range []string{`DELETE FROM subject_persons`, `DELETE FROM subject_staff_sets`} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		insertSet, err := tx.Prepare(`INSERT INTO subject_staff_sets (subject_id, project_id) VALUES (?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertSet.Close()
+		upsertPerson, err := tx.Prepare(`INSERT INTO persons (id, name, type, career, images) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET name = excluded.name, type = excluded.type, career = excluded.career, images = excluded.images`)
+		if err != nil {
+			return err
+		}
+		defer upsertPerson.Close()
+		insertLink, err := tx.Prepare(`INSERT INTO subject_persons (subject_id, position, person_id, relation, eps) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertLink.Close()
+
+		for _, collection := range staffs {
+			if _, err := insertSet.Exec(collection.OriginalID, collection.ProjectID); err != nil {
+				return fmt.Errorf("写入条目 %d 的Staff失败: %v", collection.OriginalID, err)
+			}
+			for i, person := range collection.JsonSubjectPersons {
+				if _, err := upsertPerson.Exec(person.ID, person.Name, person.Type, mustJSON(person.Career), mustJSON(person.Images)); err != nil {
+					return err
+				}
+				if _, err := insertLink.Exec(collection.OriginalID, i, person.ID, person.Relation, person.Eps); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func readRelationsDB() ([]JsonSubjectRelationCollection, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(`SELECT subject_id, project_id FROM subject_relation_sets ORDER BY project_id, subject_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var relations []JsonSubjectRelationCollection
+	indexByID := make(map[int]int)
+	for rows.Next() {
+		collection := JsonSubjectRelationCollection{JsonSubjectRelations: []JsonSubjectRelation{}}
+		if err := rows.Scan(&collection.OriginalID, &collection.ProjectID); err != nil {
+			return nil, err
+		}
+		indexByID[collection.OriginalID] = len(relations)
+		relations = append(relations, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(relations) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	relationRows, err := conn.Query(`SELECT subject_id, related_id, relation, name, name_cn, type, images
+		FROM subject_relations ORDER BY subject_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer relationRows.Close()
+	for relationRows.Next() {
+		var (
+			subjectID int
+			relation  JsonSubjectRelation
+			images    string
+		)
+		if err := relationRows.Scan(&subjectID, &relation.ID, &relation.Relation, &relation.Name, &relation.NameCn, &relation.Type, &images); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(images), &relation.Images)
+		if i, exists := indexByID[subjectID]; exists {
+			relations[i].JsonSubjectRelations = append(relations[i].JsonSubjectRelations, relation)
+		}
+	}
+	return relations, relationRows.Err()
+}
+
+func writeRelationsDB(relations []JsonSubjectRelationCollection) error {
+	return WithTx(func(tx *sql.Tx) error {
+		for _, stmt := range []string{`DELETE FROM subject_relations`, `DELETE FROM subject_relation_sets`} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		insertSet, err := tx.Prepare(`INSERT INTO subject_relation_sets (subject_id, project_id) VALUES (?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertSet.Close()
+		insertRelation, err := tx.Prepare(`INSERT INTO subject_relations (subject_id, position, related_id, relation, name, name_cn, type, images)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertRelation.Close()
+
+		for _, collection := range relations {
+			if _, err := insertSet.Exec(collection.OriginalID, collection.ProjectID); err != nil {
+				return fmt.Errorf("写入条目 %d 的关系失败: %v", collection.OriginalID, err)
+			}
+			for i, r := range collection.JsonSubjectRelations {
+				if _, err := insertRelation.Exec(collection.OriginalID, i, r.ID, r.Relation, r.Name, r.NameCn, r.Type, mustJSON(r.Images)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func writeAnimeRemapDB(data []JsonSubject) error {
+	return WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM anime_remap`); err != nil {
+			return err
+		}
+		insert, err := tx.Prepare(`INSERT INTO anime_remap (project_id, original_id) VALUES (?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+		for _, item := range data {
+			if _, err := insert.Exec(item.ProjectID, item.OriginalID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ------------------------- SQLite实现 -------------------------
+
+type sqliteStore struct{}
+
+func (sqliteStore) LoadSubjects() ([]JsonSubject, error)  { return readSubjectsDB() }
+func (sqliteStore) SaveSubjects(list []JsonSubject) error { return writeSubjectsDB(list) }
+func (sqliteStore) LoadStaffs() ([]JsonSubjectPersonCollection, error) {
+	return readStaffsDB()
+}
+func (sqliteStore) SaveStaffs(staffs []JsonSubjectPersonCollection) error {
+	return writeStaffsDB(staffs)
+}
+func (sqliteStore) LoadRelations() ([]JsonSubjectRelationCollection, error) {
+	return readRelationsDB()
+}
+func (sqliteStore) SaveRelations(relations []JsonSubjectRelationCollection) error {
+	return writeRelationsDB(relations)
+}
+
+// 条目的标签、Infobox 和 Staff 分表存放，需关联读取，这里整体读出后逐个回调
+func (sqliteStore) EachSubject(fn func(JsonSubject) error) error {
+	list, err := readSubjectsDB()
+	if err != nil {
+		return err
+	}
+	return eachItem(list, fn)
+}
+
+func (sqliteStore) EachStaff(fn func(JsonSubjectPersonCollection) error) error {
+	staffs, err := readStaffsDB()
+	if err != nil {
+		return err
+	}
+	return eachItem(staffs, fn)
+}
+
+func (sqliteStore) EachRelation(fn func(JsonSubjectRelationCollection) error) error {
+	relations, err := readRelationsDB()
+	if err != nil {
+		return err
+	}
+	return eachItem(relations, fn)
+}
+
+// 映射表同时写入数据库和CSV，CSV便于外部使用
+func (sqliteStore) SaveIDMap(list []JsonSubject) error {
+	if err := writeAnimeRemapDB(list); err != nil {
+		return err
+	}
+	return writeRemapCSV(list)
+}
+
+// ------------------------- JSON与数据库互相转换 -------------------------
+
+// 把一种存储中的条目、Staff和关系数据复制到另一种，来源中没有的部分跳过
+func copySubjects(from, to Store) error {
+	if subjects, err := from.LoadSubjects(); err == nil {
+		if err := to.SaveSubjects(subjects); err != nil {
+			return fmt.Errorf("写入条目失败: %v", err)
+		}
+		if err := to.SaveIDMap(subjects); err != nil {
+			return fmt.Errorf("写入映射表失败: %v", err)
+		}
+		fmt.Printf("已复制条目 %d 个\n", len(subjects))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if staffs, err := from.LoadStaffs(); err == nil {
+		if err := to.SaveStaffs(staffs); err != nil {
+			return fmt.Errorf("写入Staff失败: %v", err)
+		}
+		fmt.Printf("已复制Staff %d 个条目\n", len(staffs))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if relations, err := from.LoadRelations(); err == nil {
+		if err := to.SaveRelations(relations); err != nil {
+			return fmt.Errorf("写入关系失败: %v", err)
+		}
+		fmt.Printf("已复制关系 %d 个条目\n", len(relations))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 把JSON文件中的数据导入数据库
+func ImportDB() error {
+	return copySubjects(fsStore{}, sqliteStore{})
+}
+
+// 把数据库中的数据导出为JSON文件
+func ExportDB() error {
+	return copySubjects(sqliteStore{}, fsStore{})
+}
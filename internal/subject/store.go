@@ -0,0 +1,257 @@
+package subject
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 存储接口 -------------------------
+// 条目、Staff、关系数据和条目映射表的读写都经过 Store，
+// 默认按 STORAGE 选择文件或SQLite实现，测试时可通过 SetStore 换成内存实现
+
+type Store interface {
+	LoadSubjects() ([]JsonSubject, error) // 尚无数据时返回 os.ErrNotExist
+	SaveSubjects(list []JsonSubject) error
+	LoadStaffs() ([]JsonSubjectPersonCollection, error)
+	SaveStaffs(staffs []JsonSubjectPersonCollection) error
+	LoadRelations() ([]JsonSubjectRelationCollection, error)
+	SaveRelations(relations []JsonSubjectRelationCollection) error
+	SaveIDMap(list []JsonSubject) error // project_id 与 original_id 的映射表
+
+	// 逐个读取，不必一次载入全部数据；尚无数据时返回 os.ErrNotExist，fn 返回错误时停止
+	EachSubject(fn func(JsonSubject) error) error
+	EachStaff(fn func(JsonSubjectPersonCollection) error) error
+	EachRelation(fn func(JsonSubjectRelationCollection) error) error
+}
+
+var (
+	activeStore Store
+	storeMu     sync.Mutex
+)
+
+// 替换当前使用的存储实现
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	activeStore = s
+}
+
+func currentStore() Store {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if activeStore == nil {
+		if UseSQLite() {
+			activeStore = sqliteStore{}
+		} else {
+			activeStore = fsStore{}
+		}
+	}
+	return activeStore
+}
+
+// ------------------------- 读写入口 -------------------------
+
+func readExistingSubjects() ([]JsonSubject, error) {
+	return currentStore().LoadSubjects()
+}
+
+func saveSubjects(list []JsonSubject) error {
+	return currentStore().SaveSubjects(list)
+}
+
+func readExistingStaffs() ([]JsonSubjectPersonCollection, error) {
+	return currentStore().LoadStaffs()
+}
+
+func saveStaffs(staffs []JsonSubjectPersonCollection) error {
+	return currentStore().SaveStaffs(staffs)
+}
+
+func readExistingRelations() ([]JsonSubjectRelationCollection, error) {
+	return currentStore().LoadRelations()
+}
+
+func saveRelations(relations []JsonSubjectRelationCollection) error {
+	return currentStore().SaveRelations(relations)
+}
+
+func updateRemap(data []JsonSubject) {
+	if err := currentStore().SaveIDMap(data); err != nil {
+		log.Fatalf("写入映射表失败: %v", err)
+	}
+}
+
+// ------------------------- 内存实现 -------------------------
+// 保存和读取时都深拷贝，调用方修改切片或其中的标签、Infobox、Staff等不会影响已保存的数据
+
+type memStore struct {
+	mu        sync.Mutex
+	subjects  []JsonSubject
+	staffs    []JsonSubjectPersonCollection
+	relations []JsonSubjectRelationCollection
+	idMap     map[int]int // original_id -> project_id
+}
+
+func NewMemStore() Store {
+	return &memStore{}
+}
+
+func (s *memStore) LoadSubjects() ([]JsonSubject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subjects == nil {
+		return nil, fmt.Errorf("条目数据: %w", os.ErrNotExist)
+	}
+	return cloneList(s.subjects, cloneSubject), nil
+}
+
+func (s *memStore) SaveSubjects(list []JsonSubject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subjects = cloneList(list, cloneSubject)
+	return nil
+}
+
+func (s *memStore) EachSubject(fn func(JsonSubject) error) error {
+	list, err := s.LoadSubjects()
+	if err != nil {
+		return err
+	}
+	return eachItem(list, fn)
+}
+
+func (s *memStore) LoadStaffs() ([]JsonSubjectPersonCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.staffs == nil {
+		return nil, fmt.Errorf("Staff数据: %w", os.ErrNotExist)
+	}
+	return cloneList(s.staffs, cloneStaff), nil
+}
+
+func (s *memStore) SaveStaffs(staffs []JsonSubjectPersonCollection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.staffs = cloneList(staffs, cloneStaff)
+	return nil
+}
+
+func (s *memStore) EachStaff(fn func(JsonSubjectPersonCollection) error) error {
+	staffs, err := s.LoadStaffs()
+	if err != nil {
+		return err
+	}
+	return eachItem(staffs, fn)
+}
+
+func (s *memStore) LoadRelations() ([]JsonSubjectRelationCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.relations == nil {
+		return nil, fmt.Errorf("关系数据: %w", os.ErrNotExist)
+	}
+	return cloneList(s.relations, cloneRelation), nil
+}
+
+func (s *memStore) SaveRelations(relations []JsonSubjectRelationCollection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relations = cloneList(relations, cloneRelation)
+	return nil
+}
+
+func (s *memStore) EachRelation(fn func(JsonSubjectRelationCollection) error) error {
+	relations, err := s.LoadRelations()
+	if err != nil {
+		return err
+	}
+	return eachItem(relations, fn)
+}
+
+func (s *memStore) SaveIDMap(list []JsonSubject) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idMap = make(map[int]int, len(list))
+	for _, item := range list {
+		s.idMap[item.OriginalID] = item.ProjectID
+	}
+	return nil
+}
+
+func eachItem[T any](items []T, fn func(T) error) error {
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 逐个深拷贝，nil 保持为 nil
+func cloneList[T any](list []T, clone func(T) T) []T {
+	if list == nil {
+		return nil
+	}
+	cloned := make([]T, len(list))
+	for i, item := range list {
+		cloned[i] = clone(item)
+	}
+	return cloned
+}
+
+func cloneSubject(s JsonSubject) JsonSubject {
+	if s.Infobox != nil {
+		infobox := make([]Infobox, len(s.Infobox))
+		for i, item := range s.Infobox {
+			infobox[i] = Infobox{Key: item.Key, Value: cloneJSONValue(item.Value)}
+		}
+		s.Infobox = infobox
+	}
+	if s.MetaTags != nil {
+		s.MetaTags = cloneJSONValue(s.MetaTags).([]interface{})
+	}
+	if s.Tags != nil {
+		s.Tags = append([]FileTag{}, s.Tags...)
+	}
+	return s
+}
+
+func cloneStaff(c JsonSubjectPersonCollection) JsonSubjectPersonCollection {
+	c.JsonSubjectPersons = cloneList(c.JsonSubjectPersons, func(p JsonSubjectPerson) JsonSubjectPerson {
+		if p.Career != nil {
+			p.Career = append([]string{}, p.Career...)
+		}
+		return p
+	})
+	return c
+}
+
+func cloneRelation(c JsonSubjectRelationCollection) JsonSubjectRelationCollection {
+	if c.JsonSubjectRelations != nil {
+		c.JsonSubjectRelations = append([]JsonSubjectRelation{}, c.JsonSubjectRelations...)
+	}
+	return c
+}
+
+// 复制JSON解码得到的值，Infobox 的值可能是嵌套的切片和映射
+func cloneJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		cloned := make([]interface{}, len(v))
+		for i, item := range v {
+			cloned[i] = cloneJSONValue(item)
+		}
+		return cloned
+	case map[string]interface{}:
+		cloned := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			cloned[key] = cloneJSONValue(item)
+		}
+		return cloned
+	}
+	return v
+}
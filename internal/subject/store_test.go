@@ -0,0 +1,97 @@
+package subject
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	. "bgm-catch/internal/basic"
+)
+
+func TestStores(t *testing.T) {
+	useTempDataRoot := func(t *testing.T) {
+		t.Setenv("DATA_DIR", DataRoot())
+		previous := DataRoot()
+		SetDataRoot(t.TempDir())
+		t.Cleanup(func() { SetDataRoot(previous) })
+	}
+
+	stores := []struct {
+		name  string
+		setup func(t *testing.T) Store
+	}{
+		{"内存", func(t *testing.T) Store { return NewMemStore() }},
+		{"文件", func(t *testing.T) Store { useTempDataRoot(t); return fsStore{} }},
+		{"文件zstd", func(t *testing.T) Store { useTempDataRoot(t); t.Setenv("COMPRESS", "subjects:zstd"); return fsStore{} }},
+		{"文件gzip", func(t *testing.T) Store { useTempDataRoot(t); t.Setenv("COMPRESS", "gzip"); return fsStore{} }},
+	}
+
+	subjects := []JsonSubject{
+		{OriginalID: 10, ProjectID: 1, Name: "a", Tags: []FileTag{{Name: "t"}},
+			Infobox: []Infobox{{Key: "别名", Value: []interface{}{map[string]interface{}{"v": "x"}}}}},
+		{OriginalID: 20, ProjectID: 2, Name: "b"},
+	}
+	staffs := []JsonSubjectPersonCollection{{OriginalID: 10, ProjectID: 1, JsonSubjectPersons: []JsonSubjectPerson{{Career: []string{"writer"}}}}}
+	relations := []JsonSubjectRelationCollection{{OriginalID: 20, ProjectID: 2, JsonSubjectRelations: []JsonSubjectRelation{{}}}}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.setup(t)
+
+			if _, err := store.LoadSubjects(); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("LoadSubjects() 尚无数据时 error = %v, want os.ErrNotExist", err)
+			}
+			if _, err := store.LoadStaffs(); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("LoadStaffs() 尚无数据时 error = %v, want os.ErrNotExist", err)
+			}
+
+			if err := store.SaveSubjects(subjects); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveStaffs(staffs); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveRelations(relations); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveIDMap(subjects); err != nil {
+				t.Fatal(err)
+			}
+
+			gotSubjects, err := store.LoadSubjects()
+			if err != nil || !reflect.DeepEqual(gotSubjects, subjects) {
+				t.Errorf("LoadSubjects() = %+v, %v, want %+v", gotSubjects, err, subjects)
+			}
+			gotStaffs, err := store.LoadStaffs()
+			if err != nil || !reflect.DeepEqual(gotStaffs, staffs) {
+				t.Errorf("LoadStaffs() = %+v, %v, want %+v", gotStaffs, err, staffs)
+			}
+			gotRelations, err := store.LoadRelations()
+			if err != nil || !reflect.DeepEqual(gotRelations, relations) {
+				t.Errorf("LoadRelations() = %+v, %v, want %+v", gotRelations, err, relations)
+			}
+
+			var names []string
+			err = store.EachSubject(func(s JsonSubject) error {
+				names = append(names, s.Name)
+				return nil
+			})
+			if err != nil || !reflect.DeepEqual(names, []string{"a", "b"}) {
+				t.Errorf("EachSubject() = %v, %v", names, err)
+			}
+
+			// 修改读出的数据（包括嵌套的标签、Infobox 和 Staff）不影响存储
+			gotSubjects[0].Name = "changed"
+			gotSubjects[0].Tags[0].Name = "changed"
+			gotSubjects[0].Infobox[0].Value.([]interface{})[0].(map[string]interface{})["v"] = "changed"
+			gotStaffs[0].JsonSubjectPersons[0].Career[0] = "changed"
+			if again, _ := store.LoadSubjects(); !reflect.DeepEqual(again, subjects) {
+				t.Errorf("修改读出的条目影响了存储: %+v", again)
+			}
+			if again, _ := store.LoadStaffs(); !reflect.DeepEqual(again, staffs) {
+				t.Errorf("修改读出的Staff影响了存储: %+v", again)
+			}
+		})
+	}
+}
@@ -67,6 +67,19 @@ type JsonSubject struct {
 	Type          int            `json:"type"`
 	Volumes       int            `json:"volumes"`
 	ProjectID     int            `json:"project_id"`
+	Status        string         `json:"status,omitempty"`      // 为空表示正常，否则为墓碑状态（deleted/merged/filtered）
+	MergedInto    int            `json:"merged_into,omitempty"` // 被合并时的目标条目ID
+	OnAir         bool           `json:"on_air,omitempty"`      // 是否出现在当前放送日历中
+	AirWeekday    int            `json:"air_weekday,omitempty"` // 放送星期（1-7），仅对放送中的条目有效
+	FetchedAt     string         `json:"fetched_at,omitempty"`  // 最近一次从API获取的时间
+}
+
+// 更新时未能正常获取的条目
+type MissingSubject struct {
+	OriginalID int
+	Reason     string // deleted / merged / filtered
+	MergedInto int
+	Detail     string
 }
 
 type JsonSubjectPerson struct {
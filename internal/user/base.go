@@ -25,20 +25,13 @@ func initLog() (*os.File, error) {
 }
 
 func resolveUserID(userID int) (fetchID string, err error) { // 通过数字ID获取用户唯一urlID
-	// 读取本地 JSON 文件
-	user, err := readUserData(userID)
-	if err != nil && os.IsNotExist(err) {
-		return strconv.Itoa(userID), nil
+	identity, err := resolveIdentity(userID)
+	if err != nil {
+		log.Printf("用户 %d 身份解析失败: %v", userID, err)
 	}
-
-	// 如果输入是数字ID且本地没有设置字符串，尝试获取用户名
-	if user.UserName == "" {
-		user.UserName = getUserName(userID)
-		if user.UserName == "" {
-			// 获取不到用户名时仍使用数字ID
-			return strconv.Itoa(userID), nil
-		}
-		return user.UserName, nil
+	if identity.UserName != "" {
+		return identity.UserName, nil
 	}
-	return user.UserName, nil
+	// 获取不到用户名时仍使用数字ID
+	return strconv.Itoa(userID), nil
 }
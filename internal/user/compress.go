@@ -0,0 +1,88 @@
+package user
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 压缩转换 -------------------------
+
+// 把已有的用户文件（users）或合并文件（merged）转换为指定压缩方式，内容不变
+func CompressData(output, method string) error {
+	switch output {
+	case "users":
+		return convertUserFiles(method)
+	case "merged":
+		for _, base := range []string{userOutputFile(), userNDJSONFile()} {
+			path, err := ConvertOutputFile(base, method)
+			if err != nil {
+				return err
+			}
+			if path != "" {
+				fmt.Printf("已转换 %s\n", path)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("未知的输出: %s", output)
+}
+
+// 平铺和分片布局的用户文件都会转换，用户索引不受影响
+func convertUserFiles(method string) error {
+	var paths []string
+	err := filepath.WalkDir(usersDir(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := userIDFromFileName(entry.Name()); ok && !entry.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		firstErr  error
+		converted int
+	)
+	sem := make(chan struct{}, runtime.NumCPU())
+	for _, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			target, err := ConvertFileCompression(path, method)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if target != path {
+				if converted++; converted%10000 == 0 {
+					log.Printf("已转换 %d 个用户文件", converted)
+				}
+			}
+		}(path)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	fmt.Printf("用户文件共 %d 个，已转换 %d 个\n", len(paths), converted)
+	return nil
+}
@@ -1,12 +1,52 @@
 package user
 
-// ------------------------- 全局配置 -------------------------
-const (
-	animeMapFile   = "data/anime_remap.csv"
-	userOutputFile = "data/user.json"
-	userMapFile    = "data/user_remap.csv"
-	dataDir        = "data"
-	usersDir       = "data/users"
+import (
+	"os"
+	"runtime"
+
+	. "bgm-catch/internal/basic"
 )
 
+// ------------------------- 全局配置 -------------------------
+// 数据文件路径，均位于数据目录下（见 DataRoot）
+func animeMapFile() string         { return DataPath("anime_remap.csv") }
+func redirectFile() string         { return DataPath("anime_redirects.csv") }
+func userOutputFile() string       { return DataPath("user.json") }
+func userNDJSONFile() string       { return DataPath("user.ndjson") }
+func userMapFile() string          { return DataPath("user_remap.csv") }
+func registryFile() string         { return DataPath("user_registry.json") }
+func identityFile() string         { return DataPath("user_identities.json") }
+func userIndexFile() string        { return DataPath("user_index.jsonl") }
+func candidatesFile() string       { return DataPath("user_candidates.csv") }
+func consentFile() string          { return DataPath("consent.json") }
+func usersDir() string             { return DataPath("users") }
+func userEventsDir() string        { return DataPath("user_events") }
+func discoverySeedsFile() string   { return DataPath("discovery_seeds.json") }
+func userEventsOutputFile() string { return DataPath("user_events.jsonl") }
+
+// 假名化导出的数据和对照表，对照表不应随数据发布
+func pseudonymOutputFile() string { return DataPath("user_pseudonymized.json") }
+func pseudonymMapFile() string    { return DataPath("pseudonym_map.csv") }
+
 var chunkSize = 100
+
+// 所有用户共用的收藏分页请求并发数
+var pageConcurrency = runtime.NumCPU() * 2
+
+// 最近多少天内有收藏变动的用户视为活跃用户，刷新时优先
+var activeWithinDays = 30
+
+// 增量更新时，距离上次完整抓取超过多少天则改为完整抓取
+var fullReconcileDays = 30
+
+// 为 true 时保留不在动画映射表中的条目收藏（project_id 记为 -1），否则丢弃
+var keepUnmappedSubjects = os.Getenv("KEEP_UNMAPPED_SUBJECTS") == "1"
+
+// 登记为不存在、私密或空的用户，超过多少天后才会在创建模式中重新检查
+var registryRecheckDays = 90
+
+// 缓存的用户身份超过多少天后重新向API确认用户名
+var identityRecheckDays = 7
+
+// 种子来源未设置上限时，每个来源最多收集的用户数
+var discoveryDefaultCap = 200
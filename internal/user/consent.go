@@ -0,0 +1,327 @@
+package user
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 授权名单 -------------------------
+// 只抓取在授权名单中的用户；研究模式下可抓取名单外的用户，但撤回授权的用户始终拒绝
+
+const scopeCrawl = "crawl" // 允许抓取收藏
+
+// 为 true 时允许抓取不在授权名单中的用户，通过 -research 参数或环境变量 RESEARCH_MODE=1 开启
+var ResearchMode = os.Getenv("RESEARCH_MODE") == "1"
+
+type Consent struct {
+	UserID    int      `json:"user_id,omitempty"`
+	UserName  string   `json:"username,omitempty"` // 可只填用户名，匹配时通过身份表换算为数字ID
+	GivenAt   string   `json:"given_at,omitempty"`
+	Scope     []string `json:"scope,omitempty"`
+	RevokedAt string   `json:"revoked_at,omitempty"`
+}
+
+type ConsentFile struct {
+	Users []Consent `json:"users"`
+}
+
+var (
+	consents       ConsentFile
+	consentsMu     sync.Mutex
+	consentsLoaded bool
+)
+
+// 只填用户名的记录换算出的数字ID，ready 关闭后 id 可读，0 表示无法换算
+type consentName struct {
+	ready chan struct{}
+	id    int
+}
+
+var (
+	consentNamesMu sync.Mutex
+	consentNameIDs = make(map[string]*consentName)
+)
+
+func init() {
+	registerUserPolicy(consentPolicy)
+}
+
+func loadConsentsLocked() {
+	if consentsLoaded {
+		return
+	}
+	consentsLoaded = true
+	data, err := os.ReadFile(consentFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取授权名单失败: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &consents); err != nil {
+		log.Printf("解析授权名单失败: %v", err)
+	}
+}
+
+// 查找用户的授权记录，按数字ID或用户名匹配；有多条记录匹配时以撤回的记录为准
+func findConsent(userID int) (Consent, bool) {
+	resolveConsentNames(userID)
+	consentsMu.Lock()
+	defer consentsMu.Unlock()
+	loadConsentsLocked()
+
+	var (
+		found  Consent
+		exists bool
+	)
+	for _, c := range consents.Users {
+		if !consentMatchesLocked(c, userID) {
+			continue
+		}
+		if c.RevokedAt != "" {
+			return c, true
+		}
+		if !exists {
+			found, exists = c, true
+		}
+	}
+	return found, exists
+}
+
+// 记录是否属于该用户：填写了数字ID时按ID比较，只填用户名时先比较缓存的身份，
+// 再比较 resolveConsentNames 换算出的数字ID，这里不发起网络请求
+func consentMatchesLocked(c Consent, userID int) bool {
+	if c.UserID != 0 {
+		return c.UserID == userID
+	}
+	if c.UserName == "" {
+		return false
+	}
+	if identity, ok := cachedIdentity(userID); ok && strings.EqualFold(c.UserName, identity.UserName) {
+		return true
+	}
+	id, ok := cachedConsentNameID(c.UserName)
+	return ok && id == userID
+}
+
+// 把名单中只填用户名的记录换算为数字ID。请求用户资料时不持有 consentsMu，避免其他授权检查等待网络请求
+func resolveConsentNames(userID int) {
+	consentsMu.Lock()
+	loadConsentsLocked()
+	var names []string
+	for _, c := range consents.Users {
+		if c.UserID == 0 && c.UserName != "" {
+			names = append(names, c.UserName)
+		}
+	}
+	consentsMu.Unlock()
+
+	identity, hasIdentity := cachedIdentity(userID)
+	for _, name := range names {
+		if hasIdentity && strings.EqualFold(name, identity.UserName) {
+			continue // 已按缓存的身份匹配，无需请求
+		}
+		consentNameID(name)
+	}
+}
+
+// 用户名换算为数字ID，结果（包括失败）在本次运行中缓存，每个用户名只请求一次；
+// 同一用户名的并发调用等待第一次请求的结果
+func consentNameID(name string) (int, bool) {
+	key := strings.ToLower(name)
+	consentNamesMu.Lock()
+	entry, exists := consentNameIDs[key]
+	if !exists {
+		entry = &consentName{ready: make(chan struct{})}
+		consentNameIDs[key] = entry
+	}
+	consentNamesMu.Unlock()
+	if exists {
+		<-entry.ready
+		return entry.id, entry.id != 0
+	}
+
+	defer close(entry.ready)
+	profile, status, err := fetchUserProfile(name)
+	if err != nil {
+		if status == 404 {
+			log.Printf("授权名单中的用户名 %s 不存在", name)
+		} else {
+			log.Printf("解析授权名单中的用户名 %s 失败: %v", name, err)
+		}
+		return 0, false
+	}
+	entry.id = profile.ID
+	return profile.ID, true
+}
+
+// 只读取已完成的换算结果，尚未换算的用户名视为不匹配
+func cachedConsentNameID(name string) (int, bool) {
+	consentNamesMu.Lock()
+	entry, exists := consentNameIDs[strings.ToLower(name)]
+	consentNamesMu.Unlock()
+	if !exists {
+		return 0, false
+	}
+	select {
+	case <-entry.ready:
+		return entry.id, entry.id != 0
+	default:
+		return 0, false
+	}
+}
+
+func consentPolicy(userID int) string {
+	consent, exists := findConsent(userID)
+	if exists && consent.RevokedAt != "" {
+		return fmt.Sprintf("已于 %s 撤回授权", consent.RevokedAt)
+	}
+	if ResearchMode {
+		return ""
+	}
+	if !exists {
+		return "不在授权名单中"
+	}
+	for _, scope := range consent.Scope {
+		if scope == scopeCrawl {
+			return ""
+		}
+	}
+	return "授权范围不包含抓取"
+}
+
+// 在授权名单中标记撤回，没有匹配的记录时新增一条撤回记录
+func revokeConsent(userID int) error {
+	resolveConsentNames(userID)
+	consentsMu.Lock()
+	defer consentsMu.Unlock()
+	loadConsentsLocked()
+
+	// 按ID或用户名匹配的记录全部标记撤回，避免仍有未撤回的记录生效
+	now := time.Now().Format("2006-01-02 15:04:05")
+	found := false
+	for i := range consents.Users {
+		if consentMatchesLocked(consents.Users[i], userID) {
+			consents.Users[i].RevokedAt = now
+			found = true
+		}
+	}
+	if !found {
+		consents.Users = append(consents.Users, Consent{UserID: userID, RevokedAt: now})
+	}
+
+	data, err := json.MarshalIndent(consents, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(consentFile(), data, 0644)
+}
+
+// ------------------------- 清除用户数据 -------------------------
+
+// 删除用户文件及所有派生数据，并在授权名单中标记撤回
+func purgeUser(userID int) error {
+	var errs []string
+	step := func(name string, err error) {
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	step("用户数据", deleteUserData(userID))
+	step("合并数据", purgeFromMergedFile(userID))
+	step("用户映射表", currentStore().DeleteUserMapEntry(userID))
+	step("假名化导出", purgeFromPseudonymizedExport(userID)) // 需在删除对照表之前
+	step("假名对照表", removeCSVRows(pseudonymMapFile(), 0, userID))
+	step("候选用户", purgeFromCandidates(userID))
+	step("变动记录", purgeUserEvents(userID))
+	step("授权名单", revokeConsent(userID)) // 需在删除身份缓存之前，以便按用户名匹配授权记录
+
+	registryMu.Lock()
+	loadRegistryLocked()
+	delete(registry, userID)
+	registryMu.Unlock()
+	saveRegistry()
+
+	identitiesMu.Lock()
+	loadIdentitiesLocked()
+	delete(identities, userID)
+	identitiesMu.Unlock()
+	saveIdentities()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func purgeFromMergedFile(userID int) error {
+	paths := append(CompressionVariants(userOutputFile()), CompressionVariants(userNDJSONFile())...)
+	for _, path := range paths {
+		err := rewriteMergedFile(path, func(u JsonUserFile) bool { return u.UserID != userID })
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 删除CSV中指定列等于用户ID的行（保留标题行），其他行保持不变
+func removeCSVRows(path string, column int, userID int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	records, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	id := strconv.Itoa(userID)
+	kept := records[:0]
+	for i, record := range records {
+		if i > 0 && len(record) > column && record[column] == id {
+			continue
+		}
+		kept = append(kept, record)
+	}
+	if len(kept) == len(records) {
+		return nil
+	}
+
+	output, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	writer := csv.NewWriter(output)
+	writer.WriteAll(kept)
+	return writer.Error()
+}
+
+func purgeFromCandidates(userID int) error {
+	candidates, err := readCandidates()
+	if err != nil || candidates == nil {
+		return err
+	}
+	kept := candidates[:0]
+	for _, c := range candidates {
+		if c.UserID != userID {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(candidates) {
+		return nil
+	}
+	return saveCandidates(kept)
+}
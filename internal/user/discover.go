@@ -0,0 +1,266 @@
+package user
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly/v2"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------- 用户发现 -------------------------
+// 只从种子文件中明确列出的来源收集候选用户，结果写入候选文件，创建前还需通过策略检查
+
+const (
+	sourceSubjectCollectors = "subject_collectors" // 条目的公开收藏用户列表，ID为条目ID
+	sourceUserFriends       = "user_friends"       // 用户的好友列表，ID为用户名或数字ID
+)
+
+// 单个种子来源
+type DiscoverySeed struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+	Cap    int    `json:"cap,omitempty"` // 该来源最多收集的用户数，0 表示使用 discoveryDefaultCap
+}
+
+type DiscoveryConfig struct {
+	Seeds []DiscoverySeed `json:"seeds"`
+}
+
+// 候选用户及其来源
+type Candidate struct {
+	UserID       int
+	UserName     string
+	Source       string // 例如 subject_collectors:12345
+	DiscoveredAt string
+}
+
+// 创建用户前的策略检查，返回不允许的原因，空字符串表示允许
+type PolicyFunc func(userID int) string
+
+var userPolicies []PolicyFunc
+
+func registerUserPolicy(fn PolicyFunc) {
+	userPolicies = append(userPolicies, fn)
+}
+
+func checkUserPolicy(userID int) string {
+	for _, policy := range userPolicies {
+		if reason := policy(userID); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// 按种子文件收集候选用户并合并进候选文件，返回本次新增的候选
+func discoverMode() ([]Candidate, error) {
+	config, err := loadDiscoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Seeds) == 0 {
+		return nil, fmt.Errorf("种子文件 %s 中没有来源，请先添加允许抓取的来源", discoverySeedsFile())
+	}
+
+	existing, err := readCandidates()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]bool, len(existing))
+	for _, c := range existing {
+		known[c.UserID] = true
+	}
+
+	var found []Candidate
+	for _, seed := range config.Seeds {
+		limit := seed.Cap
+		if limit <= 0 {
+			limit = discoveryDefaultCap
+		}
+		source := seed.Source + ":" + seed.ID
+
+		names, err := crawlSeed(seed, limit)
+		if err != nil {
+			log.Printf("来源 %s 获取失败: %v", source, err)
+			continue
+		}
+
+		added := 0
+		for _, name := range names {
+			identity, err := identityByName(name)
+			if err != nil {
+				log.Printf("来源 %s 的用户 %s 解析失败: %v", source, name, err)
+				continue
+			}
+			if known[identity.UserID] {
+				continue
+			}
+			known[identity.UserID] = true
+			found = append(found, Candidate{
+				UserID:       identity.UserID,
+				UserName:     identity.UserName,
+				Source:       source,
+				DiscoveredAt: time.Now().Format("2006-01-02 15:04:05"),
+			})
+			added++
+		}
+		log.Printf("来源 %s: 发现 %d 个用户，新增候选 %d 个", source, len(names), added)
+	}
+	saveIdentities()
+
+	if err := saveCandidates(append(existing, found...)); err != nil {
+		return found, err
+	}
+	return found, nil
+}
+
+func loadDiscoveryConfig() (DiscoveryConfig, error) {
+	var config DiscoveryConfig
+	data, err := os.ReadFile(discoverySeedsFile())
+	if os.IsNotExist(err) {
+		// 写入空的种子文件作为模板，不默认抓取任何来源
+		output, _ := json.MarshalIndent(DiscoveryConfig{Seeds: []DiscoverySeed{}}, "", "  ")
+		if err := os.WriteFile(discoverySeedsFile(), output, 0644); err != nil {
+			return config, err
+		}
+		log.Printf("种子文件 %s 不存在，已写入空模板", discoverySeedsFile())
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// 从来源页面收集用户名，最多 limit 个
+func crawlSeed(seed DiscoverySeed, limit int) ([]string, error) {
+	switch seed.Source {
+	case sourceSubjectCollectors:
+		if _, err := strconv.Atoi(seed.ID); err != nil {
+			return nil, fmt.Errorf("无效条目ID: %s", seed.ID)
+		}
+		var names []string
+		seen := make(map[string]bool)
+		for page := 1; len(names) < limit; page++ {
+			pageNames, err := crawlUserList(fmt.Sprintf("https://bgm.tv/subject/%s/collections?page=%d", seed.ID, page))
+			if err != nil {
+				return names, err
+			}
+			added := 0
+			for _, name := range pageNames {
+				if !seen[name] && len(names) < limit {
+					seen[name] = true
+					names = append(names, name)
+					added++
+				}
+			}
+			if added == 0 {
+				break // 没有新用户，已到最后一页
+			}
+			time.Sleep(time.Second)
+		}
+		return names, nil
+	case sourceUserFriends:
+		names, err := crawlUserList(fmt.Sprintf("https://bgm.tv/user/%s/friends", seed.ID))
+		if len(names) > limit {
+			names = names[:limit]
+		}
+		return names, err
+	default:
+		return nil, fmt.Errorf("未知的来源类型: %s", seed.Source)
+	}
+}
+
+// 读取页面用户列表中的用户名
+func crawlUserList(pageUrl string) ([]string, error) {
+	var (
+		names []string
+		err   error
+	)
+	c := colly.NewCollector()
+	c.SetRequestTimeout(60 * time.Second)
+	c.OnHTML("#memberUserList a.avatar[href]", func(e *colly.HTMLElement) {
+		if name, ok := strings.CutPrefix(e.Attr("href"), "/user/"); ok && name != "" {
+			names = append(names, name)
+		}
+	})
+	c.OnError(func(r *colly.Response, e error) {
+		err = fmt.Errorf("请求失败 %s: %v", pageUrl, e)
+	})
+	if e := c.Visit(pageUrl); e != nil {
+		return nil, e
+	}
+	c.Wait()
+	return names, err
+}
+
+// 通过用户名查询数字ID并缓存身份
+func identityByName(name string) (Identity, error) {
+	profile, _, err := fetchUserProfile(name)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity := Identity{
+		UserID:    profile.ID,
+		UserName:  profile.Username,
+		Nickname:  profile.Nickname,
+		Avatar:    profile.Avatar.Large,
+		Sign:      profile.Sign,
+		CheckedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	storeIdentity(identity)
+	return identity, nil
+}
+
+func readCandidates() ([]Candidate, error) {
+	file, err := os.Open(candidatesFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []Candidate
+	for i, record := range records {
+		if i == 0 || len(record) < 4 {
+			continue // 跳过标题行
+		}
+		id, err := strconv.Atoi(record[0])
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, Candidate{UserID: id, UserName: record[1], Source: record[2], DiscoveredAt: record[3]})
+	}
+	return candidates, nil
+}
+
+func saveCandidates(candidates []Candidate) error {
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].UserID < candidates[j].UserID })
+
+	file, err := os.Create(candidatesFile())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"user_id", "username", "source", "discovered_at"})
+	for _, c := range candidates {
+		writer.Write([]string{strconv.Itoa(c.UserID), c.UserName, c.Source, c.DiscoveredAt})
+	}
+	writer.Flush()
+	return writer.Error()
+}
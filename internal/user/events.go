@@ -0,0 +1,218 @@
+package user
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------- 收藏变动记录 -------------------------
+// 每次更新时比较新旧用户数据，把变动追加到 data/user_events/{id}.jsonl
+
+const (
+	eventAdded   = "added"
+	eventRemoved = "removed"
+	eventStatus  = "status"  // 收藏类型变化，例如想看 -> 在看
+	eventRate    = "rate"    // 评分变化
+	eventComment = "comment" // 评论变化
+)
+
+type CollectionEvent struct {
+	UserID    int    `json:"user_id"`
+	SubjectID int    `json:"subject_id"`
+	Kind      string `json:"kind"`
+	From      any    `json:"from,omitempty"`
+	To        any    `json:"to,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"` // 收藏本身的更新时间
+	At        string `json:"at"`                   // 发现变动的抓取时间
+}
+
+// 比较新旧数据；新数据不完整时无法判断条目是否被删除，不记录删除事件；
+// 旧数据中未完整抓取的收藏类型可能缺少条目，这些类型中新出现的条目不记录新增事件。
+// 收藏类型按条目所在的列表判断，旧数据可能没有 Type 字段；当前映射下会被过滤的条目不参与比较
+func diffUserCollections(old, updated JsonUserFile) []CollectionEvent {
+	// 条目ID -> 收藏及其所在的收藏类型
+	type entry struct {
+		subject        Subject
+		collectionType int
+	}
+	index := func(u *JsonUserFile) map[int]entry {
+		subjects := make(map[int]entry)
+		for ct := 1; ct <= 5; ct++ {
+			for _, s := range *u.collectionList(ct) {
+				s.SubjectID = resolveSubjectID(s.SubjectID)
+				if keepSubject(s.SubjectID) {
+					subjects[s.SubjectID] = entry{subject: s, collectionType: ct}
+				}
+			}
+		}
+		return subjects
+	}
+	before, after := index(&old), index(&updated)
+	at := time.Now().Format("2006-01-02 15:04:05")
+
+	incompleteBefore := make(map[int]bool)
+	for ct := 1; ct <= 5; ct++ {
+		if status, exists := old.FetchStatus[collectionTypeNames[ct-1]]; exists && status.Status != fetchOK {
+			incompleteBefore[ct] = true
+		}
+	}
+
+	var events []CollectionEvent
+	for id, current := range after {
+		s := current.subject
+		event := CollectionEvent{UserID: updated.UserID, SubjectID: id, UpdatedAt: s.UpdatedAt, At: at}
+		previous, existed := before[id]
+		if !existed {
+			if !incompleteBefore[current.collectionType] {
+				event.Kind, event.To = eventAdded, current.collectionType
+				events = append(events, event)
+			}
+			continue
+		}
+		prev := previous.subject
+		if previous.collectionType != current.collectionType {
+			event.Kind, event.From, event.To = eventStatus, previous.collectionType, current.collectionType
+			events = append(events, event)
+		}
+		if prev.Rate != s.Rate {
+			event.Kind, event.From, event.To = eventRate, prev.Rate, s.Rate
+			events = append(events, event)
+		}
+		if prev.Comment != s.Comment {
+			event.Kind, event.From, event.To = eventComment, prev.Comment, s.Comment
+			events = append(events, event)
+		}
+	}
+	if updated.isComplete() {
+		for id, previous := range before {
+			if _, exists := after[id]; !exists {
+				events = append(events, CollectionEvent{UserID: updated.UserID, SubjectID: id, Kind: eventRemoved, From: previous.collectionType, At: at})
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].SubjectID < events[j].SubjectID })
+	return events
+}
+
+func appendUserEvents(userID int, events []CollectionEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(userEventsDir(), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(userEventsDir(), fmt.Sprintf("%d.jsonl", userID)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, event := range events {
+		data, _ := json.Marshal(event)
+		writer.Write(append(data, '\n'))
+	}
+	return writer.Flush()
+}
+
+// 合并所有用户的变动记录，按时间排序输出为一个事件流
+func exportUserEvents(outputPath string) error {
+	entries, err := os.ReadDir(userEventsDir())
+	if err != nil {
+		return err
+	}
+
+	var events []CollectionEvent
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".jsonl")); err != nil {
+			continue
+		}
+		userEvents, err := readEventFile(filepath.Join(userEventsDir(), entry.Name()))
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", entry.Name(), err)
+		}
+		events = append(events, userEvents...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].At != events[j].At {
+			return events[i].At < events[j].At
+		}
+		return events[i].UserID < events[j].UserID
+	})
+	return writeEventFile(outputPath, events)
+}
+
+func readEventFile(path string) ([]CollectionEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []CollectionEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event CollectionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("跳过无效事件（%s）: %v", path, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+func writeEventFile(path string, events []CollectionEvent) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, event := range events {
+		data, _ := json.Marshal(event)
+		writer.Write(append(data, '\n'))
+	}
+	return writer.Flush()
+}
+
+// 删除用户的变动记录，并从已导出的事件流中移除
+func purgeUserEvents(userID int) error {
+	err := os.Remove(filepath.Join(userEventsDir(), fmt.Sprintf("%d.jsonl", userID)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	events, err := readEventFile(userEventsOutputFile())
+	if err != nil {
+		return err
+	}
+	kept := events[:0]
+	for _, event := range events {
+		if event.UserID != userID {
+			kept = append(kept, event)
+		}
+	}
+	if len(kept) == len(events) {
+		return nil
+	}
+	return writeEventFile(userEventsOutputFile(), kept)
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffUserCollections(t *testing.T) {
+	previous := animeIDMap
+	animeIDMap = map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8, 9: 9} // 10 无映射
+	defer func() { animeIDMap = previous }()
+
+	status := func(statuses map[string]string) map[string]TypeStatus {
+		result := make(map[string]TypeStatus)
+		for name, s := range statuses {
+			result[name] = TypeStatus{Status: s}
+		}
+		return result
+	}
+	complete := status(map[string]string{"wish": fetchOK, "collect": fetchOK, "doing": fetchOK, "on_hold": fetchOK, "dropped": fetchOK})
+
+	// 事件的关键字段：条目ID、类型、原值、新值
+	type event struct {
+		SubjectID int
+		Kind      string
+		From, To  any
+	}
+
+	tests := []struct {
+		name    string
+		old     JsonUserFile
+		updated JsonUserFile
+		want    []event
+	}{
+		{
+			name:    "新增收藏",
+			old:     JsonUserFile{FetchStatus: complete},
+			updated: JsonUserFile{Wish: []Subject{{SubjectID: 1, Type: 1}}, FetchStatus: complete},
+			want:    []event{{1, eventAdded, nil, 1}},
+		},
+		{
+			name: "旧数据该类型未完整抓取时不记录新增",
+			old: JsonUserFile{Collect: []Subject{{SubjectID: 2, Type: 2}},
+				FetchStatus: status(map[string]string{"wish": fetchOK, "collect": fetchPartial})},
+			updated: JsonUserFile{Collect: []Subject{{SubjectID: 2, Type: 2}, {SubjectID: 3, Type: 2}},
+				Wish: []Subject{{SubjectID: 4, Type: 1}}, FetchStatus: complete},
+			want: []event{{4, eventAdded, nil, 1}},
+		},
+		{
+			name:    "旧数据该类型抓取失败时不记录新增",
+			old:     JsonUserFile{FetchStatus: status(map[string]string{"doing": fetchFailed})},
+			updated: JsonUserFile{Doing: []Subject{{SubjectID: 5, Type: 3}}, FetchStatus: complete},
+			want:    nil,
+		},
+		{
+			name:    "收藏类型、评分和评论变化",
+			old:     JsonUserFile{Wish: []Subject{{SubjectID: 6, Type: 1}}, FetchStatus: complete},
+			updated: JsonUserFile{Collect: []Subject{{SubjectID: 6, Type: 2, Rate: 8, Comment: "好看"}}, FetchStatus: complete},
+			want:    []event{{6, eventStatus, 1, 2}, {6, eventRate, 0, 8}, {6, eventComment, "", "好看"}},
+		},
+		{
+			name:    "旧数据没有 Type 字段时按所在列表判断收藏类型",
+			old:     JsonUserFile{Wish: []Subject{{SubjectID: 9}}, FetchStatus: complete},
+			updated: JsonUserFile{Wish: []Subject{{SubjectID: 9, Type: 1}}, FetchStatus: complete},
+			want:    nil,
+		},
+		{
+			name:    "已无映射的条目不记录删除",
+			old:     JsonUserFile{Collect: []Subject{{SubjectID: 10, Type: 2}}, FetchStatus: complete},
+			updated: JsonUserFile{FetchStatus: complete},
+			want:    nil,
+		},
+		{
+			name:    "新数据完整时记录删除",
+			old:     JsonUserFile{Dropped: []Subject{{SubjectID: 7, Type: 5}}, FetchStatus: complete},
+			updated: JsonUserFile{FetchStatus: complete},
+			want:    []event{{7, eventRemoved, 5, nil}},
+		},
+		{
+			name:    "新数据不完整时不记录删除",
+			old:     JsonUserFile{Dropped: []Subject{{SubjectID: 8, Type: 5}}, FetchStatus: complete},
+			updated: JsonUserFile{FetchStatus: status(map[string]string{"dropped": fetchFailed})},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []event
+			for _, e := range diffUserCollections(tt.old, tt.updated) {
+				got = append(got, event{e.SubjectID, e.Kind, e.From, e.To})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffUserCollections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
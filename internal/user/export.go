@@ -0,0 +1,265 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 假名化导出 -------------------------
+// 用带密钥的哈希替换用户ID和用户名，密钥保存在数据目录之外，对照表只保留在本地
+
+// 评论与标签的处理方式
+const (
+	textKeep   = "keep"
+	textDrop   = "drop"   // 清空
+	textRedact = "redact" // 评论替换为占位符，标签替换为哈希
+)
+
+// 时间精度
+const (
+	dateFull = "full"
+	dateDay  = "day"  // 2006-01-02
+	dateWeek = "week" // 所在周的周一
+)
+
+type ExportOptions struct {
+	ExcludeIncomplete bool
+	Comments          string
+	Tags              string
+	DatePrecision     string
+}
+
+// 导出的用户，不包含用户ID、用户名和 project_id
+type PseudoUser struct {
+	UserKey string    `json:"user_key"`
+	Index   int       `json:"index"` // 按 user_key 排序后的序号，不反映注册顺序
+	Wish    []Subject `json:"wish"`
+	Collect []Subject `json:"collect"`
+	Doing   []Subject `json:"doing"`
+	OnHold  []Subject `json:"on_hold"`
+	Dropped []Subject `json:"dropped"`
+}
+
+// 读取密钥，优先使用环境变量 PSEUDONYM_SALT，其次读取 PSEUDONYM_SALT_FILE 指向的文件。
+// 密钥文件不能位于数据目录下，以免随数据一起发布或备份后泄露
+func loadPseudonymSalt() ([]byte, error) {
+	if salt := os.Getenv("PSEUDONYM_SALT"); salt != "" {
+		return []byte(salt), nil
+	}
+	path := os.Getenv("PSEUDONYM_SALT_FILE")
+	if path == "" {
+		return nil, fmt.Errorf("未设置 PSEUDONYM_SALT 或 PSEUDONYM_SALT_FILE")
+	}
+	if pathWithin(path, DataRoot()) {
+		return nil, fmt.Errorf("密钥文件 %s 位于数据目录 %s 下，请移到数据目录之外", path, DataRoot())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	salt := strings.TrimSpace(string(data))
+	if salt == "" {
+		return nil, fmt.Errorf("密钥文件 %s 为空", path)
+	}
+	return []byte(salt), nil
+}
+
+// path 是否位于 dir 之下（按绝对路径比较，并尽量解析符号链接）
+func pathWithin(path, dir string) bool {
+	resolve := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			p = real
+		}
+		return p
+	}
+	rel, err := filepath.Rel(resolve(dir), resolve(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func pseudonym(salt []byte, kind, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+func exportPseudonymized(outputPath string, options ExportOptions) error {
+	startTime := time.Now()
+	salt, err := loadPseudonymSalt()
+	if err != nil {
+		return err
+	}
+
+	type mapping struct {
+		userID   int
+		userName string
+		key      string
+	}
+	var (
+		result   []PseudoUser
+		mappings []mapping
+	)
+	err = currentStore().EachUser(func(user JsonUserFile) error {
+		if options.ExcludeIncomplete && !user.isComplete() {
+			return nil
+		}
+
+		key := pseudonym(salt, "user", strconv.Itoa(user.UserID))
+		mappings = append(mappings, mapping{userID: user.UserID, userName: user.UserName, key: key})
+
+		pseudo := PseudoUser{UserKey: key}
+		lists := []*[]Subject{&pseudo.Wish, &pseudo.Collect, &pseudo.Doing, &pseudo.OnHold, &pseudo.Dropped}
+		for ct := 1; ct <= 5; ct++ {
+			source := *user.collectionList(ct)
+			subjects := make([]Subject, 0, len(source))
+			for _, s := range source {
+				if s.Private {
+					continue // 私密收藏不导出
+				}
+				subjects = append(subjects, pseudonymizeSubject(s, salt, options))
+			}
+			*lists[ct-1] = subjects
+		}
+		result = append(result, pseudo)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].UserKey < result[j].UserKey })
+	for i := range result {
+		result[i].Index = i
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return err
+	}
+
+	// 对照表只保留在本地，不随数据发布
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].userID < mappings[j].userID })
+	file, err := os.Create(pseudonymMapFile())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"user_id", "user_name", "user_key"})
+	for _, m := range mappings {
+		writer.Write([]string{strconv.Itoa(m.userID), m.userName, m.key})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	log.Printf("假名化导出完成！总用户数: %d，耗时: %v", len(result), time.Since(startTime).Round(time.Second))
+	return nil
+}
+
+func pseudonymizeSubject(s Subject, salt []byte, options ExportOptions) Subject {
+	switch options.Comments {
+	case textDrop:
+		s.Comment = ""
+	case textRedact:
+		if s.Comment != "" {
+			s.Comment = "[redacted]"
+		}
+	}
+
+	switch options.Tags {
+	case textDrop:
+		s.Tags = []string{}
+	case textRedact:
+		tags := make([]string, len(s.Tags))
+		for i, tag := range s.Tags {
+			tags[i] = pseudonym(salt, "tag", tag)
+		}
+		s.Tags = tags
+	}
+
+	s.UpdatedAt = coarsenDate(s.UpdatedAt, options.DatePrecision)
+	return s
+}
+
+func coarsenDate(value, precision string) string {
+	if precision == dateFull || precision == "" || value == "" {
+		return value
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return ""
+	}
+	if precision == dateWeek {
+		offset := (int(t.Weekday()) + 6) % 7 // 周一为0
+		t = t.AddDate(0, 0, -offset)
+	}
+	return t.Format("2006-01-02")
+}
+
+// 根据对照表找到用户的假名，从已导出的数据中删除该用户
+func purgeFromPseudonymizedExport(userID int) error {
+	file, err := os.Open(pseudonymMapFile())
+	if err != nil {
+		return err
+	}
+	records, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil {
+		return err
+	}
+	key := ""
+	for i, record := range records {
+		if i > 0 && len(record) > 2 && record[0] == strconv.Itoa(userID) {
+			key = record[2]
+		}
+	}
+	if key == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(pseudonymOutputFile())
+	if err != nil {
+		return err
+	}
+	var users []PseudoUser
+	if err := json.Unmarshal(data, &users); err != nil {
+		return err
+	}
+	kept := users[:0]
+	for _, u := range users {
+		if u.UserKey != key {
+			kept = append(kept, u)
+		}
+	}
+	if len(kept) == len(users) {
+		return nil
+	}
+	output, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pseudonymOutputFile(), output, 0644)
+}
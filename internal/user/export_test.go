@@ -0,0 +1,51 @@
+package user
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoarsenDate(t *testing.T) {
+	tests := []struct {
+		value, precision, want string
+	}{
+		{"2026-03-12T18:30:00+08:00", dateDay, "2026-03-12"},
+		{"2026-03-12T18:30:00+08:00", dateWeek, "2026-03-09"}, // 周四 -> 周一
+		{"2026-03-15T23:59:59Z", dateWeek, "2026-03-09"},      // 周日属于前一个周一
+		{"not a date", dateDay, ""},
+	}
+	for _, tt := range tests {
+		if got := coarsenDate(tt.value, tt.precision); got != tt.want {
+			t.Errorf("coarsenDate(%q, %q) = %q, want %q", tt.value, tt.precision, got, tt.want)
+		}
+	}
+}
+
+// 密钥文件不能位于数据目录下
+func TestLoadPseudonymSalt(t *testing.T) {
+	dataRoot := useTempDataRoot(t)
+	writeSalt := func(dir string) string {
+		path := filepath.Join(dir, "salt.txt")
+		os.MkdirAll(dir, os.ModePerm)
+		if err := os.WriteFile(path, []byte(" salt \n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	outside := writeSalt(t.TempDir())
+	inside := writeSalt(filepath.Join(dataRoot, "keys"))
+
+	t.Setenv("PSEUDONYM_SALT", "")
+	t.Setenv("PSEUDONYM_SALT_FILE", outside)
+	if salt, err := loadPseudonymSalt(); err != nil || string(salt) != "salt" {
+		t.Errorf("数据目录外的密钥文件: loadPseudonymSalt() = %q, %v", salt, err)
+	}
+	for _, path := range []string{inside, filepath.Join(dataRoot, "keys", "..", "keys", "salt.txt")} {
+		t.Setenv("PSEUDONYM_SALT_FILE", path)
+		if _, err := loadPseudonymSalt(); err == nil || !strings.Contains(err.Error(), "位于数据目录") {
+			t.Errorf("loadPseudonymSalt(%s) error = %v, want 位于数据目录", path, err)
+		}
+	}
+}
@@ -5,29 +5,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
-	"time"
+
+	. "bgm-catch/internal/basic"
 )
 
 var userRemap []JsonUserFile
 
-// ------------------------- 文件操作 -------------------------
-func loadAnimeMap() error {
-	file, err := os.Open(animeMapFile)
+// ------------------------- 文件实现 -------------------------
+// 与原有目录结构一致：每个用户一个JSON文件，映射表为CSV
+
+type fsStore struct{}
+
+func (fsStore) LoadAnimeMap() (map[int]int, error) {
+	file, err := os.Open(animeMapFile())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
-	animeIDMap = make(map[int]int)
+	idMap := make(map[int]int)
 
 	// 跳过标题行
 	if _, err := reader.Read(); err != nil {
-		return err
+		return nil, err
 	}
 
 	for {
@@ -36,33 +41,77 @@ func loadAnimeMap() error {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		projectID, _ := strconv.Atoi(record[0])
 		originalID, _ := strconv.Atoi(record[1])
-		animeIDMap[originalID] = projectID
+		idMap[originalID] = projectID
+	}
+	return idMap, nil
+}
+
+// 加载条目重定向表，文件不存在时视为空表
+func loadAnimeRedirects() error {
+	animeRedirects = make(map[int]int)
+	file, err := os.Open(redirectFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// 跳过标题行
+	if _, err := reader.Read(); err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		fromID, _ := strconv.Atoi(record[0])
+		toID, _ := strconv.Atoi(record[1])
+		animeRedirects[fromID] = toID
 	}
 	return nil
 }
 
-// ------------------------- 文件操作 -------------------------
+// 当前布局下的用户文件路径（未压缩）
+func userFilePath(userID int) string {
+	if shardedLayout() {
+		return shardedUserPath(userID)
+	}
+	return flatUserPath(userID)
+}
 
-func init() {
-	os.MkdirAll(usersDir, 0755)
+// 另一种布局下的用户文件路径（未压缩）
+func otherUserFilePath(userID int) string {
+	if shardedLayout() {
+		return flatUserPath(userID)
+	}
+	return shardedUserPath(userID)
 }
 
-func saveUserData(user JsonUserFile) error {
-	user.CatchTime = time.Now().Format("2006-01-02 15:04:05")
-	data, err := json.Marshal(user)
-	if err != nil {
-		return fmt.Errorf("JSON序列化失败: %v", err)
+// 查找已存在的用户文件。迁移中断时用户分散在两种布局中，按当前布局找不到时再尝试另一种布局
+func findUserFile(userID int) string {
+	path := FindCompressed(userFilePath(userID))
+	if _, err := os.Stat(path); os.IsNotExist(err) && (shardedLayout() || mixedLayout()) {
+		return FindCompressed(otherUserFilePath(userID))
 	}
-	return os.WriteFile(filepath.Join(usersDir, fmt.Sprintf("%d.json", user.UserID)), data, 0644)
+	return path
 }
 
-func readUserData(userID int) (JsonUserFile, error) {
-	data, err := os.ReadFile(filepath.Join(usersDir, fmt.Sprintf("%d.json", userID)))
+func readUserFile(path string) (JsonUserFile, error) {
+	data, err := ReadCompressedFile(path)
 	if err != nil {
 		return JsonUserFile{}, err
 	}
@@ -74,51 +123,209 @@ func readUserData(userID int) (JsonUserFile, error) {
 	return user, nil
 }
 
-func readExistingUserIDs() (map[int]struct{}, error) {
-	entries, err := os.ReadDir(usersDir)
+// 按 COMPRESS 中 users 的设置决定是否压缩，并删除其他压缩方式的旧文件
+func (fsStore) SaveUser(user JsonUserFile) error {
+	data, err := json.Marshal(user)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("JSON序列化失败: %v", err)
+	}
+	base := userFilePath(user.UserID)
+	path := OutputPath("users", base)
+	if err := WriteCompressedFile(path, data); err != nil {
+		return err
+	}
+	if err := RemoveOtherVariants(base, path); err != nil {
+		return err
+	}
+	// 混合布局下删除另一种布局中的旧文件，避免迁移时覆盖新数据
+	if mixedLayout() {
+		if err := RemoveOtherVariants(otherUserFilePath(user.UserID), ""); err != nil {
+			return err
+		}
+	}
+	if shardedLayout() {
+		return appendUserIndex(summarizeUser(user))
+	}
+	return nil
+}
+
+func (fsStore) LoadUser(userID int) (JsonUserFile, error) {
+	return readUserFile(findUserFile(userID))
+}
+
+func (fsStore) DeleteUser(userID int) error {
+	if err := os.Remove(findUserFile(userID)); err != nil {
+		return err
+	}
+	if mixedLayout() {
+		if err := RemoveOtherVariants(otherUserFilePath(userID), ""); err != nil {
+			return err
+		}
+	}
+	if shardedLayout() {
+		return appendUserIndex(UserSummary{UserID: userID, Deleted: true})
 	}
+	return nil
+}
 
+// 分片布局下从索引读取；平铺布局下列出目录，混合布局时再遍历分片目录。用户目录不存在时视为没有用户
+func (s fsStore) UserIDs() (map[int]struct{}, error) {
 	ids := make(map[int]struct{})
+	if shardedLayout() {
+		summaries, err := readUserIndex()
+		if err != nil {
+			return nil, err
+		}
+		for id := range summaries {
+			ids[id] = struct{}{}
+		}
+		return ids, nil
+	}
+
+	entries, err := os.ReadDir(usersDir())
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
-
-		if strings.HasSuffix(entry.Name(), ".json") {
-			idStr := entry.Name()[:len(entry.Name())-5]
-			if id, err := strconv.Atoi(idStr); err == nil {
-				ids[id] = struct{}{}
-			}
+		if id, ok := userIDFromFileName(entry.Name()); ok {
+			ids[id] = struct{}{}
+		}
+	}
+	if mixedLayout() {
+		err := walkShardedUsers(func(userID int, path string) error {
+			ids[userID] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 	return ids, nil
 }
-func getUserCatchTimes() (map[int]string, error) {
-	entries, err := os.ReadDir(usersDir)
+
+// 平铺布局（包括混合布局）没有可靠的索引，需要逐个读取用户文件
+func (s fsStore) Summaries() (map[int]UserSummary, error) {
+	if shardedLayout() {
+		return readUserIndex()
+	}
+
+	ids, err := s.UserIDs()
 	if err != nil {
 		return nil, err
 	}
-
-	catchTimes := make(map[int]string)
-	for _, entry := range entries {
-		if entry.IsDir() {
+	summaries := make(map[int]UserSummary, len(ids))
+	for id := range ids {
+		user, err := s.LoadUser(id)
+		if err != nil {
 			continue
 		}
+		summaries[id] = summarizeUser(user)
+	}
+	return summaries, nil
+}
 
-		if strings.HasSuffix(entry.Name(), ".json") {
-			idStr := entry.Name()[:len(entry.Name())-5]
-			if id, err := strconv.Atoi(idStr); err == nil {
-				user, err := readUserData(id)
-				if err != nil {
-					continue
-				}
-				if user.CatchTime != "" {
-					catchTimes[id] = user.CatchTime
+func (s fsStore) EachUser(fn func(JsonUserFile) error) error {
+	return eachUserByID(s, fn)
+}
+
+// 分片布局下逐行读取索引文件，同一用户可能有多行，已删除的记录跳过；
+// 没有索引或平铺布局时遍历目录并读取每个用户文件
+func (s fsStore) EachUserKey(fn func(userID, projectID int) error) error {
+	if shardedLayout() {
+		err := eachUserIndexLine(func(summary UserSummary) error {
+			if summary.Deleted {
+				return nil
+			}
+			return fn(summary.UserID, summary.ProjectID)
+		})
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	visit := func(path string) error {
+		user, err := readUserFile(path)
+		if err != nil {
+			log.Printf("读取用户文件 %s 失败，已跳过: %v", path, err)
+			return nil
+		}
+		return fn(user.UserID, user.ProjectID)
+	}
+	if !shardedLayout() {
+		dir, err := os.Open(usersDir())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		for {
+			entries, err := dir.ReadDir(256)
+			for _, entry := range entries {
+				if _, ok := userIDFromFileName(entry.Name()); ok && !entry.IsDir() {
+					if err := visit(filepath.Join(usersDir(), entry.Name())); err != nil {
+						return err
+					}
 				}
 			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if !mixedLayout() {
+			return nil
+		}
+	}
+	return walkShardedUsers(func(userID int, path string) error {
+		return visit(path)
+	})
+}
+
+// 用户映射表始终写出CSV，便于外部使用
+func (fsStore) SaveUserMap(users []JsonUserFile) error {
+	return writeUserMapCSV(users)
+}
+
+func (fsStore) DeleteUserMapEntry(userID int) error {
+	return removeCSVRows(userMapFile(), 1, userID) // 其他用户的 project_id 保持不变
+}
+
+func writeUserMapCSV(users []JsonUserFile) error {
+	file, err := os.Create(userMapFile())
+	if err != nil {
+		return fmt.Errorf("创建映射文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	// 写入标题行
+	if err := writer.Write([]string{"project_id", "user_id", "user_name"}); err != nil {
+		return fmt.Errorf("写入CSV标题失败: %v", err)
+	}
+
+	// 写入数据行
+	for _, u := range users {
+		record := []string{
+			strconv.Itoa(u.ProjectID),
+			strconv.Itoa(u.UserID),
+			u.UserName,
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("用户 %d: CSV写入失败: %v", u.UserID, err)
 		}
 	}
-	return catchTimes, nil
+	writer.Flush()
+	return writer.Error()
 }
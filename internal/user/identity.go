@@ -0,0 +1,144 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ------------------------- 用户身份解析 -------------------------
+// 缓存数字ID与用户名的对应关系，用户改名后记录曾用名并更新为新用户名
+
+var (
+	identities       map[int]Identity
+	identitiesMu     sync.Mutex
+	identitiesLoaded bool
+)
+
+func loadIdentitiesLocked() {
+	if identitiesLoaded {
+		return
+	}
+	identitiesLoaded = true
+	identities = make(map[int]Identity)
+	data, err := os.ReadFile(identityFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取用户身份表失败: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &identities); err != nil {
+		log.Printf("解析用户身份表失败: %v", err)
+	}
+}
+
+func cachedIdentity(userID int) (Identity, bool) {
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+	loadIdentitiesLocked()
+	identity, exists := identities[userID]
+	return identity, exists
+}
+
+// 保存新的身份信息，用户名变化时把旧用户名加入曾用名
+func storeIdentity(identity Identity) {
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+	loadIdentitiesLocked()
+	if old, exists := identities[identity.UserID]; exists {
+		identity.Aliases = old.Aliases
+		if old.UserName != "" && old.UserName != identity.UserName {
+			identity.Aliases = append(identity.Aliases, Alias{UserName: old.UserName, Until: identity.CheckedAt})
+			log.Printf("用户 %d 已改名: %s -> %s", identity.UserID, old.UserName, identity.UserName)
+		}
+	}
+	identities[identity.UserID] = identity
+}
+
+func saveIdentities() {
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+	if !identitiesLoaded {
+		return
+	}
+	data, err := json.MarshalIndent(identities, "", "  ")
+	if err != nil {
+		log.Printf("用户身份表序列化失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(identityFile(), data, 0644); err != nil {
+		log.Printf("保存用户身份表失败: %v", err)
+	}
+}
+
+// 解析用户身份：缓存未过期时直接使用，否则依次尝试缓存的用户名、数字ID和网页跳转，
+// 并通过API确认返回的数字ID一致，避免使用已被他人占用的旧用户名
+func resolveIdentity(userID int) (Identity, error) {
+	cached, hasCache := cachedIdentity(userID)
+	if hasCache {
+		checkedAt, err := time.ParseInLocation("2006-01-02 15:04:05", cached.CheckedAt, time.Local)
+		if err == nil && time.Since(checkedAt) < time.Duration(identityRecheckDays)*24*time.Hour {
+			return cached, nil
+		}
+	}
+
+	var candidates []string
+	if hasCache && cached.UserName != "" {
+		candidates = append(candidates, cached.UserName)
+	}
+	candidates = append(candidates, strconv.Itoa(userID))
+
+	var lastErr error
+	tried := make(map[string]bool)
+	lookup := func(name string) (Identity, bool) {
+		if name == "" || tried[name] {
+			return Identity{}, false
+		}
+		tried[name] = true
+		profile, status, err := fetchUserProfile(name)
+		if err != nil {
+			if status != 404 {
+				lastErr = fmt.Errorf("获取用户 %s 资料失败: %v", name, err)
+			}
+			return Identity{}, false
+		}
+		if profile.ID != userID {
+			return Identity{}, false // 用户名已被其他用户使用
+		}
+		return Identity{
+			UserID:    userID,
+			UserName:  profile.Username,
+			Nickname:  profile.Nickname,
+			Avatar:    profile.Avatar.Large,
+			Sign:      profile.Sign,
+			CheckedAt: time.Now().Format("2006-01-02 15:04:05"),
+		}, true
+	}
+
+	for _, name := range candidates {
+		if identity, ok := lookup(name); ok {
+			storeIdentity(identity)
+			return identity, nil
+		}
+	}
+
+	// 设置了用户名的用户无法按数字ID查询，通过网页跳转获取当前用户名
+	name, err := getUserNameByRedirect(userID)
+	if err != nil {
+		lastErr = fmt.Errorf("获取用户 %d 用户名失败: %v", userID, err)
+	}
+	if identity, ok := lookup(name); ok {
+		storeIdentity(identity)
+		return identity, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("用户 %d 不存在", userID)
+	}
+	return cached, lastErr
+}
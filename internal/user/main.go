@@ -3,16 +3,21 @@ package user
 import (
 	"bufio"
 	"fmt"
+	"iter"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	. "bgm-catch/internal/basic"
 )
 
 var (
-	animeIDMap map[int]int
-	userIDMap  map[int]int
+	animeIDMap     map[int]int
+	animeRedirects map[int]int // 被合并条目ID -> 合并目标ID
+	userIDMap      map[int]int
 )
 
 func Main() {
@@ -22,61 +27,221 @@ func Main() {
 	}
 	defer logFile.Close()
 
+	if err := os.MkdirAll(DataRoot(), os.ModePerm); err != nil {
+		log.Fatalf("创建数据目录失败: %v", err)
+	}
+
+	// 与其他写入用户数据的进程（手动运行或定时任务）互斥
+	lock, err := LockData(LockUser, true)
+	if err != nil {
+		log.Fatalf("获取数据锁失败: %v", err)
+	}
+	defer lock.Unlock()
+
+	// 读取条目映射表期间持有条目数据的共享锁，避免读到条目模块写了一半的文件
+	subjectLock, err := LockData(LockSubject, false)
+	if err != nil {
+		log.Fatalf("获取数据锁失败: %v", err)
+	}
 	if err := loadAnimeMap(); err != nil {
 		log.Fatalf("加载动画映射表失败: %v", err)
 	}
+	if err := loadAnimeRedirects(); err != nil {
+		log.Fatalf("加载条目重定向表失败: %v", err)
+	}
+	subjectLock.Unlock()
+
+	if ResearchMode {
+		log.Println("研究模式已开启：允许抓取不在授权名单中的用户")
+	}
 
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("请选择模式(C=创建/U=更新/R=重新映射/M=合并数据/D=拆分数据): ")
+	SetStdin(reader)
+	fmt.Print("请选择模式(C=创建/F=发现用户/U=更新/I=增量更新/R=重新映射/M=合并数据/X=假名化导出/E=导出变动记录/D=拆分数据/P=清除用户): ")
 	mode, _ := reader.ReadString('\n')
 	mode = strings.ToUpper(strings.TrimSpace(mode))
 
 	switch mode {
 	case "C":
-		fmt.Print("请输入用户ID或范围（例如：1001 或 1001-2000）: ")
+		fmt.Print("请输入用户ID或范围（例如：1001 或 1001-2000,!1500-1600 或 @ids.txt）: ")
 		input, _ := reader.ReadString('\n')
-		userIDs, err := ParseIDList(strings.TrimSpace(input))
+		expr, err := ParseIDExpr(strings.TrimSpace(input), ScopeUser)
 		if err != nil {
 			log.Fatal("输入解析失败:", err)
 		}
-		createMode(userIDs)
+		createMode(expr)
+	case "F":
+		found, err := discoverMode()
+		if err != nil {
+			log.Fatal("发现用户失败:", err)
+		}
+		fmt.Printf("新增候选用户 %d 个，已写入 %s\n", len(found), candidatesFile())
+		if len(found) == 0 {
+			return
+		}
+		fmt.Print("是否立即创建新增的候选用户？(y/N): ")
+		confirm, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(confirm)) != "y" {
+			return
+		}
+		ids := make([]string, len(found))
+		for i, c := range found {
+			ids[i] = strconv.Itoa(c.UserID)
+		}
+		expr, err := ParseIDExpr(strings.Join(ids, ","), ScopeUser)
+		if err != nil {
+			log.Fatal("输入解析失败:", err)
+		}
+		createMode(expr)
 	case "U":
-		fmt.Print("请输入要更新的用户ID或范围（输入'all'更新所有用户，输入'empty'更新所有Data为空的用户）: ")
+		fmt.Print("请输入要更新的用户ID或范围（输入'all'更新所有用户，输入'empty'更新所有Data为空的用户，输入'stale'按过期程度在预算内刷新，输入'failed'只重新获取失败的收藏类型，也支持users-stale>7d等表达式）: ")
 		input, _ := reader.ReadString('\n')
-		input = strings.ToUpper(strings.TrimSpace(input))
+		input = strings.TrimSpace(input)
 		var userIDs []int
-		if strings.Contains(input, "ALL") {
+		if strings.ToUpper(input) == "ALL" {
 			userIDs, err = getAllUserIDs()
 			if err != nil {
 				log.Fatal("获取所有用户ID失败:", err)
 			}
-		} else if strings.Contains(input, "EMPTY") {
+		} else if strings.ToUpper(input) == "STALE" {
+			fmt.Print("请输入本次预算（请求数和/或时长，例如：5000 或 30m 或 5000,30m，留空不限）: ")
+			budgetInput, _ := reader.ReadString('\n')
+			budget, err := ParseRefreshBudget(budgetInput)
+			if err != nil {
+				log.Fatal("预算解析失败:", err)
+			}
+			var requests int
+			userIDs, requests, err = planStaleUsers(budget)
+			if err != nil {
+				log.Fatal("生成刷新计划失败:", err)
+			}
+			log.Printf("刷新计划: %d 个用户，预计 %d 次请求", len(userIDs), requests)
+			updateMode(slices.Values(userIDs), budget.Deadline(time.Now()), updateFull)
+			return
+		} else if strings.ToUpper(input) == "FAILED" {
+			userIDs, err = getIncompleteUsers()
+			if err != nil {
+				log.Fatal("获取未完整抓取的用户ID失败:", err)
+			}
+			updateMode(slices.Values(userIDs), time.Time{}, updateFailedTypes)
+			return
+		} else if strings.ToUpper(input) == "EMPTY" {
 			userIDs, err = getUsersWithEmptyData()
 			if err != nil {
 				log.Fatal("获取Data为空的用户ID失败:", err)
 			}
 		} else {
-			userIDs, err = ParseIDList(input)
+			expr, err := ParseIDExpr(input, ScopeUser)
 			if err != nil {
 				log.Fatal("输入解析失败:", err)
 			}
+			updateMode(expr.All(), time.Time{}, updateFull)
+			return
 		}
-		updateMode(userIDs)
+		updateMode(slices.Values(userIDs), time.Time{}, updateFull)
+	case "I":
+		fmt.Print("请输入要增量更新的用户ID或范围（输入'all'更新所有用户）: ")
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		var userIDs iter.Seq[int]
+		if strings.ToUpper(input) == "ALL" {
+			allIDs, err := getAllUserIDs()
+			if err != nil {
+				log.Fatal("获取所有用户ID失败:", err)
+			}
+			userIDs = slices.Values(allIDs)
+		} else {
+			expr, err := ParseIDExpr(input, ScopeUser)
+			if err != nil {
+				log.Fatal("输入解析失败:", err)
+			}
+			userIDs = expr.All()
+		}
+		updateMode(userIDs, time.Time{}, updateIncremental)
 	case "R":
 		generateUserMap()
 		fmt.Println("用户映射表已重新生成")
 	case "M":
-		if err := mergeUserFiles(userOutputFile); err != nil {
+		fmt.Print("是否排除抓取不完整的用户？(y/N): ")
+		excludeInput, _ := reader.ReadString('\n')
+		excludeIncomplete := strings.ToLower(strings.TrimSpace(excludeInput)) == "y"
+		fmt.Print("输出格式（json/ndjson，默认json）: ")
+		basePath := userOutputFile()
+		if readChoice(reader, formatJSON, formatJSON, formatNDJSON) == formatNDJSON {
+			basePath = userNDJSONFile()
+		}
+		outputPath := OutputPath("merged", basePath)
+		if err := mergeUserFiles(outputPath, excludeIncomplete); err != nil {
 			log.Fatal("合并失败:", err)
 		}
-		fmt.Printf("数据已合并至 %s\n", userOutputFile)
+		if err := RemoveOtherVariants(basePath, outputPath); err != nil {
+			log.Printf("删除旧的合并文件失败: %v", err)
+		}
+		fmt.Printf("数据已合并至 %s\n", outputPath)
+	case "X":
+		var options ExportOptions
+		fmt.Print("是否排除抓取不完整的用户？(y/N): ")
+		excludeInput, _ := reader.ReadString('\n')
+		options.ExcludeIncomplete = strings.ToLower(strings.TrimSpace(excludeInput)) == "y"
+		fmt.Print("评论处理方式（keep/drop/redact，默认drop）: ")
+		options.Comments = readChoice(reader, textDrop, textKeep, textDrop, textRedact)
+		fmt.Print("标签处理方式（keep/drop/redact，默认redact）: ")
+		options.Tags = readChoice(reader, textRedact, textKeep, textDrop, textRedact)
+		fmt.Print("收藏时间精度（full/day/week，默认day）: ")
+		options.DatePrecision = readChoice(reader, dateDay, dateFull, dateDay, dateWeek)
+		if err := exportPseudonymized(pseudonymOutputFile(), options); err != nil {
+			log.Fatal("导出失败:", err)
+		}
+		fmt.Printf("数据已导出至 %s，对照表 %s 请勿发布\n", pseudonymOutputFile(), pseudonymMapFile())
+	case "E":
+		if err := exportUserEvents(userEventsOutputFile()); err != nil {
+			log.Fatal("导出变动记录失败:", err)
+		}
+		fmt.Printf("变动记录已导出至 %s\n", userEventsOutputFile())
 	case "D":
-		if err := splitUserFile(userOutputFile); err != nil {
+		defaultInput := FindCompressed(userOutputFile())
+		fmt.Printf("请输入要拆分的文件（支持JSON数组或NDJSON，可为.gz/.zst压缩文件，默认 %s）: ", defaultInput)
+		inputPath, _ := reader.ReadString('\n')
+		inputPath = strings.TrimSpace(inputPath)
+		if inputPath == "" {
+			inputPath = defaultInput
+		}
+		if err := splitUserFile(inputPath); err != nil {
 			log.Fatal("拆分失败:", err)
 		}
 		fmt.Println("数据拆分完成")
+	case "P":
+		fmt.Print("请输入撤回授权的用户ID（将删除其用户文件及所有派生数据）: ")
+		input, _ := reader.ReadString('\n')
+		expr, err := ParseIDExpr(strings.TrimSpace(input), ScopeUser)
+		if err != nil {
+			log.Fatal("输入解析失败:", err)
+		}
+		for userID := range expr.All() {
+			if err := purgeUser(userID); err != nil {
+				log.Printf("清除用户 %d 时部分数据删除失败: %v", userID, err)
+				continue
+			}
+			log.Printf("已清除用户 %d 的全部数据", userID)
+		}
 	default:
 		log.Fatal("无效模式选择")
 	}
 
 }
+
+// 读取一行选项，留空时使用默认值
+func readChoice(reader *bufio.Reader, defaultValue string, choices ...string) string {
+	input, _ := reader.ReadString('\n')
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return defaultValue
+	}
+	for _, choice := range choices {
+		if input == choice {
+			return input
+		}
+	}
+	log.Fatalf("无效选项: %s", input)
+	return ""
+}
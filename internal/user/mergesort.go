@@ -0,0 +1,198 @@
+package user
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ------------------------- 合并顺序的外部排序 -------------------------
+// 合并用户数据时按 project_id、user_id 输出。排序键每满一批就排序后写入临时文件，
+// 全部写完后多路归并依次输出，内存中最多保留一批键，与用户总数无关
+
+const mergeRunSize = 100000 // 每批排序的键数
+
+type mergeKey struct {
+	projectID int
+	userID    int
+}
+
+func (k mergeKey) less(other mergeKey) bool {
+	if k.projectID != other.projectID {
+		return k.projectID < other.projectID
+	}
+	return k.userID < other.userID
+}
+
+type keySorter struct {
+	runSize int    // 每批的键数，为 0 时使用 mergeRunSize
+	dir     string // 临时目录，第一次溢写时创建
+	batch   []mergeKey
+	runs    []string
+	count   int
+}
+
+func (s *keySorter) Add(key mergeKey) error {
+	s.batch = append(s.batch, key)
+	s.count++
+	runSize := s.runSize
+	if runSize <= 0 {
+		runSize = mergeRunSize
+	}
+	if len(s.batch) >= runSize {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *keySorter) Len() int {
+	return s.count
+}
+
+func (s *keySorter) sortBatch() {
+	sort.Slice(s.batch, func(i, j int) bool { return s.batch[i].less(s.batch[j]) })
+}
+
+// 把当前批次排序后写入临时文件，每个键两个 int64
+func (s *keySorter) spill() error {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "bgm-merge-keys-")
+		if err != nil {
+			return fmt.Errorf("创建排序临时目录失败: %v", err)
+		}
+		s.dir = dir
+	}
+	s.sortBatch()
+
+	path := filepath.Join(s.dir, fmt.Sprintf("run_%d", len(s.runs)))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, key := range s.batch {
+		if err := binary.Write(writer, binary.LittleEndian, [2]int64{int64(key.projectID), int64(key.userID)}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, path)
+	s.batch = s.batch[:0]
+	return nil
+}
+
+// 按顺序对每个键调用 fn，fn 返回错误时停止
+func (s *keySorter) Each(fn func(mergeKey) error) error {
+	// 没有溢写过时直接在内存中排序
+	if len(s.runs) == 0 {
+		s.sortBatch()
+		for _, key := range s.batch {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(s.batch) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	h := &runHeap{}
+	defer func() {
+		for _, run := range *h {
+			run.file.Close()
+		}
+	}()
+	for _, path := range s.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		run := &keyRun{file: file, reader: bufio.NewReader(file)}
+		ok, err := run.next()
+		if err != nil || !ok {
+			file.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		heap.Push(h, run)
+	}
+
+	for h.Len() > 0 {
+		run := (*h)[0]
+		if err := fn(run.head); err != nil {
+			return err
+		}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			run.file.Close()
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// 删除临时文件
+func (s *keySorter) Close() error {
+	s.batch = nil
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	s.runs = nil
+	return err
+}
+
+// 一个已排序的临时文件，head 为当前最小的键
+type keyRun struct {
+	file   *os.File
+	reader *bufio.Reader
+	head   mergeKey
+}
+
+func (r *keyRun) next() (bool, error) {
+	var pair [2]int64
+	if err := binary.Read(r.reader, binary.LittleEndian, &pair); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("读取排序临时文件失败: %v", err)
+	}
+	r.head = mergeKey{projectID: int(pair[0]), userID: int(pair[1])}
+	return true, nil
+}
+
+type runHeap []*keyRun
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].head.less(h[j].head) }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*keyRun)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
@@ -0,0 +1,62 @@
+package user
+
+import (
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestKeySorter(t *testing.T) {
+	tests := []struct {
+		name    string
+		runSize int
+		count   int
+	}{
+		{"没有键", 4, 0},
+		{"只在内存中排序", 100, 50},
+		{"多个临时文件归并", 7, 100},
+		{"恰好整批", 10, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(tt.count)))
+			var want []mergeKey
+			sorter := &keySorter{runSize: tt.runSize}
+			for i := 0; i < tt.count; i++ {
+				key := mergeKey{projectID: rng.Intn(20), userID: i}
+				want = append(want, key)
+				if err := sorter.Add(key); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			sort.Slice(want, func(i, j int) bool { return want[i].less(want[j]) })
+
+			var got []mergeKey
+			if err := sorter.Each(func(key mergeKey) error {
+				got = append(got, key)
+				return nil
+			}); err != nil {
+				t.Fatalf("Each() error = %v", err)
+			}
+			if sorter.Len() != tt.count {
+				t.Errorf("Len() = %d, want %d", sorter.Len(), tt.count)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Each() order = %v, want %v", got, want)
+			}
+
+			dir := sorter.dir
+			if err := sorter.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if dir != "" {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("临时目录 %s 未删除", dir)
+				}
+			}
+		})
+	}
+}
@@ -1,57 +1,91 @@
 package user
 
 import (
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"github.com/schollz/progressbar/v3"
+	"iter"
 	"log"
-	"os"
-	"path/filepath"
 	"runtime"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
+
+	. "bgm-catch/internal/basic"
 )
 
-func createMode(userIDs []int) {
+func createMode(expr *IDExpr) {
 	chunkSize := 100
-	totalChunks := (len(userIDs) + chunkSize - 1) / chunkSize
+	// 按批次惰性展开，避免大范围一次性分配
+	totalUsers := expr.Count()
+	totalChunks := (totalUsers + chunkSize - 1) / chunkSize
 
-	bar := progressbar.NewOptions(len(userIDs),
+	bar := progressbar.NewOptions(totalUsers,
 		progressbar.OptionSetDescription("总体进度"),
 		progressbar.OptionShowCount(),
 	)
 
-	for chunkIdx := 0; chunkIdx < len(userIDs); chunkIdx += chunkSize {
-		end := chunkIdx + chunkSize
-		if end > len(userIDs) {
-			end = len(userIDs)
+	batchNumber := 0
+	skipped := 0
+	rejected := 0
+	for batchIDs := range Chunk(expr.All(), chunkSize) {
+		batchNumber++
+		// 跳过未通过策略检查的ID，以及登记表中已知无效且未到重新检查时间的ID
+		pending := batchIDs[:0]
+		for _, id := range batchIDs {
+			if reason := checkUserPolicy(id); reason != "" {
+				log.Printf("拒绝用户 %d: %s", id, reason)
+				rejected++
+				bar.Add(1)
+				continue
+			}
+			if entry, skip := shouldSkipUser(id); skip {
+				log.Printf("跳过用户 %d（%s，检查于 %s）", id, entry.Outcome, entry.CheckedAt)
+				skipped++
+				bar.Add(1)
+				continue
+			}
+			pending = append(pending, id)
 		}
-		batchIDs := userIDs[chunkIdx:end]
-
-		processCreateBatch(batchIDs, (chunkIdx/chunkSize)+1, totalChunks, bar)
+		processCreateBatch(pending, batchNumber, totalChunks, bar)
+		saveRegistry()
+		saveIdentities()
+	}
+	if skipped > 0 {
+		log.Printf("共跳过 %d 个已登记的无效用户（%d 天后重新检查）", skipped, registryRecheckDays)
+	}
+	if rejected > 0 {
+		log.Printf("共拒绝 %d 个未通过策略检查的用户", rejected)
 	}
 
 	log.Printf("正在整理数据，分配project_id！")
 	// 处理完成后不再重新生成映射，需要手动调用
 	//generateUserMap()
-	log.Printf("创建成功！总处理用户数: %d\n", len(userIDs))
+	log.Printf("创建成功！总处理用户数: %d\n", totalUsers)
 }
 
-func updateMode(userIDs []int) {
+// 更新方式
+const (
+	updateFull        = iota // 完整抓取全部收藏类型
+	updateIncremental        // 只获取上次抓取后变动的收藏
+	updateFailedTypes        // 只重新获取未完整抓取的收藏类型
+)
+
+// deadline 不为零时，到达截止时间后不再开始新的批次
+func updateMode(userIDs iter.Seq[int], deadline time.Time, kind int) {
 	// 读取现有用户ID集合
 	existingIDs, err := readExistingUserIDs()
 	if err != nil {
 		log.Fatal("读取现有用户ID失败:", err)
 	}
 
-	// 过滤有效用户ID
+	// 过滤有效用户ID，有效ID不超过已有用户数，输入的范围不会整体展开
 	var validUserIDs []int
-	for _, uid := range userIDs {
+	for uid := range userIDs {
 		if _, exists := existingIDs[uid]; exists {
+			if reason := checkUserPolicy(uid); reason != "" {
+				log.Printf("拒绝更新用户 %d: %s", uid, reason)
+				continue
+			}
 			validUserIDs = append(validUserIDs, uid)
 		}
 	}
@@ -61,13 +95,19 @@ func updateMode(userIDs []int) {
 	totalChunks := (totalUsers + chunkSize - 1) / chunkSize
 
 	for chunkIdx := 0; chunkIdx < totalUsers; chunkIdx += chunkSize {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			log.Printf("已到达时间预算，剩余 %d 个用户留待下次刷新", totalUsers-chunkIdx)
+			break
+		}
 		end := chunkIdx + chunkSize
 		if end > totalUsers {
 			end = totalUsers
 		}
 		currentChunk := validUserIDs[chunkIdx:end]
 
-		processUpdateBatch(currentChunk, (chunkIdx/chunkSize)+1, totalChunks)
+		processUpdateBatch(currentChunk, (chunkIdx/chunkSize)+1, totalChunks, kind)
+		saveRegistry()
+		saveIdentities()
 	}
 
 	log.Printf("正在整理数据，分配project_id！")
@@ -75,7 +115,7 @@ func updateMode(userIDs []int) {
 	log.Printf("更新全部完成！总用户数: %d", len(existingIDs))
 }
 
-func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int) {
+func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int, kind int) {
 	var (
 		wg           sync.WaitGroup
 		successCount int
@@ -83,7 +123,11 @@ func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int) {
 		mu           sync.Mutex
 	)
 
-	results := make(chan JsonUserFile, len(batchIDs))
+	type updateResult struct {
+		user   JsonUserFile
+		events []CollectionEvent
+	}
+	results := make(chan updateResult, len(batchIDs))
 	sem := make(chan struct{}, runtime.NumCPU()*2)
 
 	bar := progressbar.NewOptions(len(batchIDs),
@@ -112,7 +156,15 @@ func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int) {
 			}
 
 			// 处理更新
-			updatedUser, err := processUser(userID)
+			var updatedUser JsonUserFile
+			switch kind {
+			case updateIncremental:
+				updatedUser, _, err = processUserIncremental(existingUser)
+			case updateFailedTypes:
+				updatedUser, err = refetchFailedTypes(existingUser)
+			default:
+				updatedUser, err = processUser(userID)
+			}
 			if err != nil {
 				mu.Lock()
 				failureCount++
@@ -121,9 +173,11 @@ func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int) {
 				return
 			}
 
+			recordOutcome(userID, userOutcome(updatedUser))
+
 			// 保留原有ProjectID
 			updatedUser.ProjectID = existingUser.ProjectID
-			results <- updatedUser
+			results <- updateResult{user: updatedUser, events: diffUserCollections(existingUser, updatedUser)}
 			bar.Add(1)
 			mu.Lock()
 			successCount++
@@ -137,9 +191,13 @@ func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int) {
 	}()
 
 	// 保存本批次结果
-	for u := range results {
-		if err := saveUserData(u); err != nil {
-			log.Printf("用户 %d 保存失败: %v", u.UserID, err)
+	for r := range results {
+		if err := saveUserData(r.user); err != nil {
+			log.Printf("用户 %d 保存失败: %v", r.user.UserID, err)
+			continue
+		}
+		if err := appendUserEvents(r.user.UserID, r.events); err != nil {
+			log.Printf("用户 %d 变动记录写入失败: %v", r.user.UserID, err)
 		}
 	}
 
@@ -149,39 +207,35 @@ func processUpdateBatch(batchIDs []int, batchNumber int, totalChunks int) {
 		batchNumber, totalChunks, successCount, failureCount, duration)
 }
 
+// 流式读取合并文件（JSON数组或NDJSON）并拆分为独立文件
 func splitUserFile(inputPath string) error {
 	startTime := time.Now()
 	log.Printf("开始拆分用户数据文件...")
 
-	// 读取原始大文件
-	data, err := os.ReadFile(inputPath)
+	file, err := OpenCompressed(inputPath)
 	if err != nil {
 		return fmt.Errorf("文件读取失败: %v", err)
 	}
+	defer file.Close()
 
-	// 解析JSON数据
-	var users []JsonUserFile
-	if err := json.Unmarshal(data, &users); err != nil {
-		return fmt.Errorf("JSON解析失败: %v", err)
-	}
-
-	totalUsers := len(users)
-	bar := progressbar.NewOptions(totalUsers,
+	bar := progressbar.NewOptions(-1,
 		progressbar.OptionSetDescription("拆分进度"),
 		progressbar.OptionShowCount(),
 	)
 
+	totalUsers := 0
 	successCount := 0
 	failureCount := 0
 	sem := make(chan struct{}, runtime.NumCPU()*2) // 并发控制
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
-	for _, user := range users {
+	err = readUserStream(file, func(user JsonUserFile) error {
+		totalUsers++
 		wg.Add(1)
+		sem <- struct{}{}
 		go func(u JsonUserFile) {
 			defer wg.Done()
-			sem <- struct{}{}
 			defer func() { <-sem }()
 
 			// 检查数据有效性
@@ -207,9 +261,13 @@ func splitUserFile(inputPath string) error {
 			mu.Unlock()
 			bar.Add(1)
 		}(user)
-	}
+		return nil
+	})
 
 	wg.Wait()
+	if err != nil {
+		return err
+	}
 
 	// 处理完成后不再重新生成映射，需要手动调用
 	//generateUserMap()
@@ -228,25 +286,18 @@ func generateUserMap() {
 	var deletedUsers []JsonUserFile // 记录被删除的空用户
 
 	// 读取所有用户数据
-	entries, err := os.ReadDir(usersDir)
+	existingIDs, err := readExistingUserIDs()
 	if err != nil {
-		log.Fatal("读取用户目录失败:", err)
+		log.Fatal("读取用户列表失败:", err)
 	}
+	userIDs := make([]int, 0, len(existingIDs))
+	for userID := range existingIDs {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
 
 	var users []JsonUserFile
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
-			continue
-		}
-
-		// 解析用户ID
-		idStr := entry.Name()[:len(entry.Name())-5]
-		userID, err := strconv.Atoi(idStr)
-		if err != nil {
-			log.Printf("跳过无效文件名: %s", entry.Name())
-			continue
-		}
-
+	for _, userID := range userIDs {
 		// 读取用户数据
 		user, err := readUserData(userID)
 		if err != nil {
@@ -259,11 +310,12 @@ func generateUserMap() {
 
 		// 检查所有收藏是否为空
 		if isEmptyUserData(user) {
-			// 删除用户文件
-			filePath := filepath.Join(usersDir, entry.Name())
-			if err := os.Remove(filePath); err != nil {
+			// 删除用户数据
+			if err := deleteUserData(userID); err != nil {
 				log.Printf("删除用户 %d 文件失败: %v", userID, err)
 			} else {
+				// 登记为空用户，避免创建模式反复抓取
+				recordOutcome(userID, outcomeEmpty)
 				deletedUsers = append(deletedUsers, user)
 				log.Printf("已删除空用户: ID=%-8d | 用户名=%s", user.UserID, user.UserName)
 			}
@@ -273,6 +325,8 @@ func generateUserMap() {
 		users = append(users, user)
 	}
 
+	saveRegistry()
+
 	// 输出清除结果
 	if len(deletedUsers) > 0 {
 		log.Println("\n=== 已删除空用户统计 ===")
@@ -297,31 +351,8 @@ func generateUserMap() {
 		}
 	}
 
-	// 生成CSV文件
-	file, err := os.Create(userMapFile)
-	if err != nil {
-		log.Fatal("创建映射文件失败:", err)
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// 写入标题行
-	if err := writer.Write([]string{"project_id", "user_id", "user_name"}); err != nil {
-		log.Fatal("写入CSV标题失败:", err)
-	}
-
-	// 写入数据行
-	for _, u := range users {
-		record := []string{
-			strconv.Itoa(u.ProjectID),
-			strconv.Itoa(u.UserID),
-			u.UserName,
-		}
-		if err := writer.Write(record); err != nil {
-			log.Printf("跳过用户 %d: CSV写入失败: %v", u.UserID, err)
-		}
+	if err := currentStore().SaveUserMap(users); err != nil {
+		log.Fatalf("写入映射表失败: %v", err)
 	}
 
 	log.Printf("映射表生成完成！有效用户数: %d | 耗时: %v",
@@ -331,12 +362,35 @@ func generateUserMap() {
 
 // 更新用户收藏动画的 project_id
 func updateAnimeProjectIDs(user *JsonUserFile) {
+	// 用户直接收藏了合并目标时保留该收藏，丢弃重定向过来的旧条目
+	direct := make(map[int]struct{})
+	for ct := 1; ct <= 5; ct++ {
+		for _, subject := range *user.collectionList(ct) {
+			if resolveSubjectID(subject.SubjectID) == subject.SubjectID {
+				direct[subject.SubjectID] = struct{}{}
+			}
+		}
+	}
+	seen := make(map[int]struct{})
 	update := func(list *[]Subject) {
 		newList := make([]Subject, 0, len(*list))
 		for _, subject := range *list {
+			originalID := subject.SubjectID
+			subject.SubjectID = resolveSubjectID(originalID)
+			if _, hasTarget := direct[subject.SubjectID]; hasTarget && originalID != subject.SubjectID {
+				continue
+			}
+			if _, dup := seen[subject.SubjectID]; dup {
+				continue // 重定向后与已有条目重复
+			}
 			if projectID, exists := animeIDMap[subject.SubjectID]; exists {
+				seen[subject.SubjectID] = struct{}{}
 				subject.ProjectID = projectID
 				newList = append(newList, subject)
+			} else if keepUnmappedSubjects {
+				seen[subject.SubjectID] = struct{}{}
+				subject.ProjectID = -1
+				newList = append(newList, subject)
 			} else {
 				log.Printf("用户 %d: 动画ID %d 无映射关系，已过滤", user.UserID, subject.SubjectID)
 			}
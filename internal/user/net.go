@@ -11,84 +11,211 @@ import (
 	"time"
 )
 
-func getUserName(userID int) string {
+// 用户API地址，测试时替换为本地服务
+var userAPIBase = "https://api.bgm.tv/v0/users"
+
+// 通过 bgm.tv/user/{id} 的跳转获取用户名，仅在API无法按数字ID查询时使用；没有跳转时返回空字符串
+func getUserNameByRedirect(userID int) (string, error) {
 	var err error
 	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
 		var resp *http.Response
 		resp, err = http.Get(fmt.Sprintf("https://bgm.tv/user/%d", userID))
-		if err == nil {
-			defer resp.Body.Close()
-			if resp.Request.URL.Path != fmt.Sprintf("/user/%d", userID) {
-				parts := strings.Split(resp.Request.URL.Path, "/")
-				if len(parts) > 2 {
-					return parts[2]
-				}
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+			continue
+		}
+		if resp.Request.URL.Path != fmt.Sprintf("/user/%d", userID) {
+			parts := strings.Split(resp.Request.URL.Path, "/")
+			if len(parts) > 2 {
+				return parts[2], nil
 			}
-			return ""
 		}
+		return "", nil
 	}
-	log.Printf("获取用户名失败: %v", err)
-	return ""
+	return "", err
 }
 
-func fetchUserData(fetchId string, collectionType int) ([]Collection, error) {
-	var result []Collection
-	offset := 0
-	limit := 40
+// 通过 /v0/users/{username} 获取用户资料，返回HTTP状态码以区分用户不存在与其他错误
+func fetchUserProfile(username string) (apiUser, int, error) {
+	var (
+		profile apiUser
+		status  int
+		err     error
+	)
+	url := fmt.Sprintf("%s/%s", userAPIBase, username)
 
-	c := colly.NewCollector()
-	c.SetRequestTimeout(60 * time.Second)
-	c.Async = true
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		err = nil
+
+		c := colly.NewCollector()
+		c.SetRequestTimeout(60 * time.Second)
+		c.OnResponse(func(r *colly.Response) {
+			status = r.StatusCode
+			if e := json.Unmarshal(r.Body, &profile); e != nil {
+				err = fmt.Errorf("解析用户资料失败: %v", e)
+			}
+		})
+		c.OnError(func(r *colly.Response, e error) {
+			status = 0
+			if r != nil {
+				status = r.StatusCode
+			}
+			err = e
+		})
+		if e := c.Visit(url); e != nil {
+			err = e
+		}
+		c.Wait()
 
-	url := fmt.Sprintf("https://api.bgm.tv/v0/users/%s/collections?subject_type=2&type=%d", fetchId, collectionType)
+		if err == nil || status == 404 {
+			break
+		}
+	}
+	return profile, status, err
+}
 
-	var mu sync.Mutex
-	var lastErr error
-	requestedOffsets := make(map[int]bool) // **记录已请求的 offset**
+// 分页获取失败时的错误，记录出错的分页偏移
+type fetchError struct {
+	Offset     int
+	StatusCode int // HTTP状态码，网络错误时为0
+	Err        error
+}
+
+func (e *fetchError) Error() string {
+	return fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+}
 
-	for {
-		if requestedOffsets[offset] {
-			log.Printf("跳过重复请求 offset=%d", offset)
-			break // **如果该 offset 已请求，则跳过**
+// 所有用户共用的分页请求并发上限
+var pageSem = make(chan struct{}, pageConcurrency)
+
+// 请求单个分页，每次请求使用新的collector，避免回调重复注册
+func fetchPage(pageUrl string) (ApiResponse, int, error) {
+	pageSem <- struct{}{}
+	defer func() { <-pageSem }()
+
+	var (
+		response ApiResponse
+		status   int
+		err      error
+	)
+	c := colly.NewCollector()
+	c.SetRequestTimeout(60 * time.Second)
+	c.OnResponse(func(r *colly.Response) {
+		if e := json.Unmarshal(r.Body, &response); e != nil {
+			err = fmt.Errorf("解析失败 %s: %v", pageUrl, e)
+		}
+	})
+	c.OnError(func(r *colly.Response, e error) {
+		if r != nil {
+			status = r.StatusCode
+		}
+		err = fmt.Errorf("请求失败 %s: %v", pageUrl, e)
+	})
+	// 同步请求时4xx/5xx会让 Visit 返回错误，此时 OnError 已记录状态码
+	if e := c.Visit(pageUrl); e != nil {
+		if err == nil {
+			err = e
 		}
-		requestedOffsets[offset] = true // **标记为已请求**
+		return response, status, err
+	}
+	c.Wait()
+	return response, status, err
+}
 
-		currentUrl := fmt.Sprintf("%s&limit=%d&offset=%d", url, limit, offset)
-		var response ApiResponse
+// 获取失败时返回已成功获取的部分数据和 *fetchError
+// since 不为零时只获取 updated_at 不早于 since 的收藏；接口按 updated_at 倒序返回，遇到更早的条目即停止翻页
+// 完整获取时先从第一页读取总数，再并发请求其余分页并按顺序拼接
+func fetchUserData(fetchId string, collectionType int, since time.Time) ([]Collection, error) {
+	const limit = 40
+	url := fmt.Sprintf("%s/%s/collections?subject_type=2&type=%d", userAPIBase, fetchId, collectionType)
+	pageUrl := func(offset int) string {
+		return fmt.Sprintf("%s&limit=%d&offset=%d", url, limit, offset)
+	}
 
-		c.OnResponse(func(r *colly.Response) {
-			mu.Lock()
-			defer mu.Unlock()
+	first, status, err := fetchPage(pageUrl(0))
+	if err != nil {
+		return nil, &fetchError{Offset: 0, StatusCode: status, Err: err}
+	}
+	if !since.IsZero() {
+		return fetchSince(first, pageUrl, limit, since)
+	}
 
-			if err := json.Unmarshal(r.Body, &response); err != nil {
-				lastErr = fmt.Errorf("解析失败 %s: %v", currentUrl, err)
+	pageCount := (first.Total + limit - 1) / limit
+	pages := make([][]Collection, max(pageCount, 1))
+	pages[0] = first.Data
+	pageErrs := make([]*fetchError, len(pages))
+
+	var wg sync.WaitGroup
+	for i := 1; i < pageCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, status, err := fetchPage(pageUrl(i * limit))
+			if err != nil {
+				pageErrs[i] = &fetchError{Offset: i * limit, StatusCode: status, Err: err}
 				return
 			}
+			pages[i] = response.Data
+		}(i)
+	}
+	wg.Wait()
 
-			result = append(result, response.Data...)
-		})
-
-		c.OnError(func(r *colly.Response, err error) {
-			mu.Lock()
-			lastErr = fmt.Errorf("请求失败 %s: %v", currentUrl, err)
-			mu.Unlock()
-		})
-
-		if err := c.Visit(currentUrl); err != nil {
-			return nil, err
+	// 按分页顺序拼接并去重，出错时只返回出错分页之前的连续数据
+	var result []Collection
+	seen := make(map[int]bool)
+	for i, page := range pages {
+		if pageErrs[i] != nil {
+			return result, pageErrs[i]
 		}
+		for _, item := range page {
+			if seen[item.SubjectID] {
+				continue
+			}
+			seen[item.SubjectID] = true
+			result = append(result, item)
+		}
+	}
 
-		c.Wait() // **等待当前请求完成**
+	if len(result) != first.Total {
+		log.Printf("用户 %s 类型 %d 获取数量 %d 与总数 %d 不一致", fetchId, collectionType, len(result), first.Total)
+	}
+	return result, nil
+}
 
-		// **检查是否达到最后一页**
-		if lastErr != nil {
-			return nil, lastErr
+// 增量获取：逐页请求，遇到早于 since 的条目即停止
+func fetchSince(first ApiResponse, pageUrl func(int) string, limit int, since time.Time) ([]Collection, error) {
+	var result []Collection
+	response := first
+	for offset := 0; ; {
+		for _, item := range response.Data {
+			updatedAt, err := time.Parse(time.RFC3339, item.UpdatedAt)
+			if err == nil && updatedAt.Before(since) {
+				return result, nil // 已到达上次抓取过的数据
+			}
+			result = append(result, item)
 		}
-		if len(response.Data) < limit {
-			break // **如果返回的数据不足 limit，说明到最后一页，停止请求**
+		if len(response.Data) < limit || offset+limit >= response.Total {
+			return result, nil
 		}
 
-		offset += limit // **正确更新 offset**
+		offset += limit
+		var (
+			status int
+			err    error
+		)
+		response, status, err = fetchPage(pageUrl(offset))
+		if err != nil {
+			return result, &fetchError{Offset: offset, StatusCode: status, Err: err}
+		}
 	}
-	return result, nil
 }
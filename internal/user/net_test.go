@@ -0,0 +1,31 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 用户不存在时每个收藏类型都返回404，应记录状态码并判定为不存在
+func TestNotFoundOutcome(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"title":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+	previous := userAPIBase
+	userAPIBase = server.URL + "/v0/users"
+	defer func() { userAPIBase = previous }()
+
+	user := JsonUserFile{UserID: 1}
+	for ct := 1; ct <= 5; ct++ {
+		fetchCollectionType(&user, "1", ct)
+	}
+	for name, status := range user.FetchStatus {
+		if status.StatusCode != http.StatusNotFound {
+			t.Errorf("FetchStatus[%s].StatusCode = %d, want 404", name, status.StatusCode)
+		}
+	}
+	if outcome := userOutcome(user); outcome != outcomeNotFound {
+		t.Errorf("userOutcome() = %q, want %q", outcome, outcomeNotFound)
+	}
+}
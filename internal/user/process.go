@@ -1,18 +1,17 @@
 package user
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/schollz/progressbar/v3"
-	"io/fs"
 	"log"
 	"os"
 	"runtime"
-	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
+
+	. "bgm-catch/internal/basic"
 )
 
 func processUser(userID int) (JsonUserFile, error) {
@@ -24,40 +23,21 @@ func processUser(userID int) (JsonUserFile, error) {
 	}
 
 	user := JsonUserFile{
-		UserID: userID,
+		UserID:      userID,
+		FetchStatus: make(map[string]TypeStatus),
 	}
 	if fetchID != strconv.Itoa(userID) {
 		user.UserName = fetchID
 	}
 
 	// 获取所有收藏类型的数据
-	var collections [5][]Collection
-	// processUser: 确保数据去重
 	for ct := 1; ct <= 5; ct++ {
-		data, err := fetchUserData(fetchID, ct)
-		if err != nil {
-			log.Printf("用户 %s 类型 %d 数据获取失败: %v", fetchID, ct, err)
-			continue
-		}
-
-		// **确保每个类型的数据是唯一的**
-		uniqueData := make(map[int]Collection)
-		for _, item := range data {
-			uniqueData[item.SubjectID] = item
-		}
-
-		collections[ct-1] = make([]Collection, 0, len(uniqueData))
-		for _, v := range uniqueData {
-			collections[ct-1] = append(collections[ct-1], v)
-		}
+		fetchCollectionType(&user, fetchID, ct)
+	}
+	// 只有全部收藏类型都完整获取时才算完成完整同步，否则增量更新仍会改为完整抓取
+	if user.isComplete() {
+		user.FullSyncTime = time.Now().Format("2006-01-02 15:04:05")
 	}
-
-	// 处理并过滤数据
-	user.Wish = processCollections(collections[0])
-	user.Collect = processCollections(collections[1])
-	user.Doing = processCollections(collections[2])
-	user.OnHold = processCollections(collections[3])
-	user.Dropped = processCollections(collections[4])
 
 	//// 有效性检查
 	//totalEntries := len(user.Data.Wish) + len(user.Data.Collect) +
@@ -70,28 +50,130 @@ func processUser(userID int) (JsonUserFile, error) {
 	return user, nil
 }
 
+// 获取单个收藏类型并记录抓取状态，失败时保留已获取的部分数据
+func fetchCollectionType(user *JsonUserFile, fetchID string, collectionType int) {
+	data, err := fetchUserData(fetchID, collectionType, time.Time{})
+	status := TypeStatus{Status: fetchOK}
+	if err != nil {
+		log.Printf("用户 %s 类型 %d 数据获取失败: %v", fetchID, collectionType, err)
+		status = TypeStatus{Status: fetchFailed, Error: err.Error()}
+		if fe, ok := err.(*fetchError); ok {
+			status.StatusCode = fe.StatusCode
+			if len(data) > 0 {
+				status = TypeStatus{Status: fetchPartial, Offset: fe.Offset, StatusCode: fe.StatusCode, Error: fe.Err.Error()}
+			}
+		}
+	}
+
+	// **确保每个类型的数据是唯一的**
+	uniqueData := make(map[int]Collection)
+	for _, item := range data {
+		uniqueData[item.SubjectID] = item
+	}
+	collections := make([]Collection, 0, len(uniqueData))
+	for _, v := range uniqueData {
+		collections = append(collections, v)
+	}
+
+	// 处理并过滤数据
+	*user.collectionList(collectionType) = processCollections(collections)
+	if user.FetchStatus == nil {
+		user.FetchStatus = make(map[string]TypeStatus)
+	}
+	user.FetchStatus[collectionTypeNames[collectionType-1]] = status
+}
+
+// 只重新获取未完整抓取的收藏类型
+func refetchFailedTypes(existing JsonUserFile) (JsonUserFile, error) {
+	fetchID, err := resolveUserID(existing.UserID)
+	if err != nil {
+		return existing, err
+	}
+	refetched := false
+	for ct := 1; ct <= 5; ct++ {
+		if status, exists := existing.FetchStatus[collectionTypeNames[ct-1]]; exists && status.Status != fetchOK {
+			fetchCollectionType(&existing, fetchID, ct)
+			refetched = true
+		}
+	}
+	// 补齐失败的类型后各类型均已完整获取，视为完成一次完整同步
+	if refetched && existing.isComplete() {
+		existing.FullSyncTime = time.Now().Format("2006-01-02 15:04:05")
+	}
+	return existing, nil
+}
+
+// 存在未完整抓取收藏类型的用户
+func getIncompleteUsers() ([]int, error) {
+	existingIDs, err := readExistingUserIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for id := range existingIDs {
+		user, err := readUserData(id)
+		if err != nil {
+			continue
+		}
+		if !user.isComplete() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 func processCollections(collections []Collection) []Subject {
 	var result []Subject
 	existingSubjects := make(map[int]struct{})
 
 	for _, c := range collections {
-		if pid, exists := animeIDMap[c.SubjectID]; exists {
-			if _, seen := existingSubjects[c.SubjectID]; !seen {
-				result = append(result, Subject{
-					SubjectID: c.SubjectID,
-					ProjectID: pid,
-					Tags:      c.Tags,
-					Comment:   c.Comment,
-					Rate:      c.Rate,
-					UpdatedAt: c.UpdatedAt,
-				})
-				existingSubjects[c.SubjectID] = struct{}{}
+		subjectID := resolveSubjectID(c.SubjectID)
+		pid, exists := animeIDMap[subjectID]
+		if !exists {
+			if !keepUnmappedSubjects {
+				continue
 			}
+			pid = -1
+		}
+		if _, seen := existingSubjects[subjectID]; !seen {
+			result = append(result, Subject{
+				SubjectID: subjectID,
+				ProjectID: pid,
+				Tags:      c.Tags,
+				Comment:   c.Comment,
+				Rate:      c.Rate,
+				UpdatedAt: c.UpdatedAt,
+				Type:      c.Type,
+				EpStatus:  c.EpStatus,
+				VolStatus: c.VolStatus,
+				Private:   c.Private,
+				Info:      c.Subject,
+			})
+			existingSubjects[subjectID] = struct{}{}
 		}
 	}
 	return result
 }
 
+// 当前映射下是否保留该条目：有 project_id 映射，或设置了保留无映射的条目
+func keepSubject(subjectID int) bool {
+	_, exists := animeIDMap[subjectID]
+	return exists || keepUnmappedSubjects
+}
+
+// 沿重定向表找到条目的最终ID（被合并的条目指向合并目标）
+func resolveSubjectID(subjectID int) int {
+	for i := 0; i < 10; i++ { // 防止重定向成环
+		target, exists := animeRedirects[subjectID]
+		if !exists {
+			break
+		}
+		subjectID = target
+	}
+	return subjectID
+}
+
 func getAllUserIDs() ([]int, error) {
 	existingIDs, err := readExistingUserIDs()
 	if err != nil {
@@ -105,42 +187,19 @@ func getAllUserIDs() ([]int, error) {
 	return ids, nil
 }
 
+// 根据用户概要筛选，分片布局下只读索引
 func getUsersWithEmptyData() ([]int, error) {
-	existingIDs, err := readExistingUserIDs()
+	summaries, err := readUserSummaries()
 	if err != nil {
 		return nil, err
 	}
 
 	var emptyUsers []int
-	chunkSize := 500 // 分批检查
-
-	// 分批处理避免内存问题
-	ids := make([]int, 0, len(existingIDs))
-	for id := range existingIDs {
-		ids = append(ids, id)
-	}
-
-	total := len(ids)
-	for i := 0; i < total; i += chunkSize {
-		end := i + chunkSize
-		if end > total {
-			end = total
+	for id, summary := range summaries {
+		if summary.Empty {
+			emptyUsers = append(emptyUsers, id)
 		}
-
-		var batchEmpty []int
-		for _, uid := range ids[i:end] {
-			user, err := readUserData(uid)
-			if err != nil {
-				continue
-			}
-
-			if isEmptyUserData(user) {
-				batchEmpty = append(batchEmpty, uid)
-			}
-		}
-		emptyUsers = append(emptyUsers, batchEmpty...)
 	}
-
 	return emptyUsers, nil
 }
 
@@ -153,93 +212,75 @@ func isEmptyUserData(user JsonUserFile) bool {
 }
 
 // ------------------------- 合并功能 -------------------------
-func mergeUserFiles(outputPath string) error {
+// excludeIncomplete 为 true 时跳过存在未完整抓取收藏类型的用户
+// 存储逐个提供用户ID和 project_id，直接送入外部排序，再按顺序逐个读取并写出，内存中不保留全部用户
+func mergeUserFiles(outputPath string, excludeIncomplete bool) error {
 	startTime := time.Now()
 	log.Printf("开始合并用户数据...")
 
-	entries, err := os.ReadDir(usersDir)
+	// 按 project_id、user_id 外部排序，排序键分批写入临时文件
+	sorter := &keySorter{}
+	defer sorter.Close()
+	err := currentStore().EachUserKey(func(userID, projectID int) error {
+		return sorter.Add(mergeKey{userID: userID, projectID: projectID})
+	})
 	if err != nil {
 		return err
 	}
 
-	totalFiles := len(entries)
-	bar := progressbar.NewOptions(totalFiles,
+	bar := progressbar.NewOptions(sorter.Len(),
 		progressbar.OptionSetDescription("合并进度"),
 		progressbar.OptionShowCount(),
 	)
 
-	result := make([]JsonUserFile, 0, totalFiles)
-	errCh := make(chan error, 1)
-	doneCh := make(chan struct{})
-
-	// 使用并行处理加速读取
-	go func() {
-		sem := make(chan struct{}, runtime.NumCPU()*2)
-		var mu sync.Mutex
-
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
+	// 写入文件，按扩展名压缩
+	file, err := CreateCompressed(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-			sem <- struct{}{}
-			go func(e fs.DirEntry) {
-				defer func() { <-sem }()
-
-				if strings.HasSuffix(e.Name(), ".json") {
-					idStr := e.Name()[:len(e.Name())-5]
-					userID, err := strconv.Atoi(idStr)
-					if err != nil {
-						return
-					}
-
-					user, err := readUserData(userID)
-					if err != nil {
-						select {
-						case errCh <- fmt.Errorf("读取用户 %d 失败: %v", userID, err):
-						default:
-						}
-						return
-					}
-
-					mu.Lock()
-					result = append(result, user)
-					mu.Unlock()
-					bar.Add(1)
-				}
-			}(entry)
+	writer := newUserWriter(file, mergedFormat(outputPath))
+	var (
+		total    int
+		previous mergeKey
+	)
+	err = sorter.Each(func(key mergeKey) error {
+		bar.Add(1)
+		if key == previous {
+			return nil // 索引中同一用户的重复记录
 		}
+		previous = key
 
-		// 等待所有goroutine完成
-		for i := 0; i < cap(sem); i++ {
-			sem <- struct{}{}
+		user, err := readUserData(key.userID)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // 记录过期，用户已删除
 		}
-		close(doneCh)
-	}()
-
-	select {
-	case err := <-errCh:
-		return err
-	case <-doneCh:
-	}
-
-	// 排序
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].ProjectID < result[j].ProjectID
+		if err != nil {
+			return fmt.Errorf("读取用户 %d 失败: %v", key.userID, err)
+		}
+		// project_id 不一致说明是过期记录，该用户按最新的 project_id 另有一条
+		if user.ProjectID != key.projectID || (excludeIncomplete && !user.isComplete()) {
+			return nil
+		}
+		if err := writer.Write(user); err != nil {
+			return err
+		}
+		total++
+		return nil
 	})
-
-	// 写入文件
-	data, err := json.MarshalIndent(result, "", "  ")
 	if err != nil {
 		return err
 	}
-
-	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil { // 压缩流在关闭时写出剩余数据
 		return err
 	}
 
 	log.Printf("合并完成！总用户数: %d，耗时: %v",
-		len(result),
+		total,
 		time.Since(startTime).Round(time.Second))
 	return nil
 }
@@ -271,6 +312,17 @@ func processCreateBatch(batchIDs []int, batchNumber int, totalChunks int, bar *p
 				return
 			}
 
+			outcome := userOutcome(user)
+			recordOutcome(userID, outcome)
+			if outcome == outcomeNotFound || outcome == outcomePrivate {
+				mu.Lock()
+				failureCount++
+				mu.Unlock()
+				log.Printf("用户 %d 无法获取（%s），已登记", userID, outcome)
+				bar.Add(1)
+				return
+			}
+
 			if err := saveUserData(user); err != nil {
 				mu.Lock()
 				failureCount++
@@ -291,3 +343,98 @@ func processCreateBatch(batchIDs []int, batchNumber int, totalChunks int, bar *p
 	log.Printf("批次 %d/%d 完成 | 成功: %d | 失败: %d | 耗时: %v",
 		batchNumber, totalChunks, successCount, failureCount, duration)
 }
+
+// 按过期程度和活跃度规划需要刷新的用户
+func planStaleUsers(budget RefreshBudget) ([]int, int, error) {
+	existingIDs, err := readExistingUserIDs()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	activeSince := now.AddDate(0, 0, -activeWithinDays)
+	items := make([]RefreshItem, 0, len(existingIDs))
+	for id := range existingIDs {
+		user, err := readUserData(id)
+		if err != nil {
+			log.Printf("读取用户 %d 数据失败: %v", id, err)
+			continue
+		}
+
+		item := RefreshItem{ID: id}
+		if catchTime, err := time.ParseInLocation("2006-01-02 15:04:05", user.CatchTime, time.Local); err == nil {
+			item.LastFetched = catchTime
+		}
+		// 每种收藏类型至少请求一页，每页40条
+		for _, list := range [][]Subject{user.Wish, user.Collect, user.Doing, user.OnHold, user.Dropped} {
+			item.Cost += len(list)/40 + 1
+			for _, s := range list {
+				if updatedAt, err := time.Parse(time.RFC3339, s.UpdatedAt); err == nil && updatedAt.After(activeSince) {
+					item.Active = true
+				}
+			}
+		}
+		items = append(items, item)
+	}
+
+	ids, requests := PlanRefresh(items, budget, now)
+	return ids, requests, nil
+}
+
+// 增量更新单个用户：只获取上次抓取后变动的收藏并合并到现有数据
+// 超过 fullReconcileDays 未完整抓取的用户改为完整抓取，以发现被删除的收藏
+func processUserIncremental(existing JsonUserFile) (JsonUserFile, bool, error) {
+	lastFullSync, err := time.ParseInLocation("2006-01-02 15:04:05", existing.FullSyncTime, time.Local)
+	if err != nil || time.Since(lastFullSync) > time.Duration(fullReconcileDays)*24*time.Hour {
+		user, err := processUser(existing.UserID)
+		return user, true, err
+	}
+
+	// 以已保存收藏中最新的 updated_at 作为水位线（CatchTime 在重新映射等操作时也会刷新，不够可靠）
+	var watermark time.Time
+	lists := []*[]Subject{&existing.Wish, &existing.Collect, &existing.Doing, &existing.OnHold, &existing.Dropped}
+	for _, list := range lists {
+		for _, s := range *list {
+			if updatedAt, err := time.Parse(time.RFC3339, s.UpdatedAt); err == nil && updatedAt.After(watermark) {
+				watermark = updatedAt
+			}
+		}
+	}
+	if watermark.IsZero() {
+		user, err := processUser(existing.UserID)
+		return user, true, err
+	}
+
+	fetchID, err := resolveUserID(existing.UserID)
+	if err != nil {
+		return existing, false, err
+	}
+
+	var changed [5][]Subject
+	changedIDs := make(map[int]struct{})
+	for ct := 1; ct <= 5; ct++ {
+		data, err := fetchUserData(fetchID, ct, watermark)
+		if err != nil {
+			return existing, false, fmt.Errorf("类型 %d 数据获取失败: %v", ct, err)
+		}
+		changed[ct-1] = processCollections(data)
+		for _, s := range changed[ct-1] {
+			changedIDs[s.SubjectID] = struct{}{}
+		}
+	}
+
+	// 变动的条目先从所有列表中移除，再加入新的收藏类型
+	for i, list := range lists {
+		kept := make([]Subject, 0, len(*list))
+		for _, s := range *list {
+			if _, isChanged := changedIDs[s.SubjectID]; !isChanged {
+				kept = append(kept, s)
+			}
+		}
+		*list = append(kept, changed[i]...)
+	}
+	if fetchID != strconv.Itoa(existing.UserID) {
+		existing.UserName = fetchID
+	}
+	return existing, false, nil
+}
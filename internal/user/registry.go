@@ -0,0 +1,114 @@
+package user
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ------------------------- 用户ID登记表 -------------------------
+// 记录每个用户ID最近一次抓取的结果，创建模式据此跳过已知无效的ID
+
+const (
+	outcomeOK       = "ok"
+	outcomeNotFound = "not_found" // 用户不存在或已注销
+	outcomePrivate  = "private"   // 收藏不公开
+	outcomeEmpty    = "empty"     // 没有任何可用的动画收藏
+)
+
+type RegistryEntry struct {
+	Outcome   string `json:"outcome"`
+	CheckedAt string `json:"checked_at"`
+}
+
+var (
+	registry       map[int]RegistryEntry
+	registryMu     sync.Mutex
+	registryLoaded bool
+)
+
+func loadRegistryLocked() {
+	if registryLoaded {
+		return
+	}
+	registryLoaded = true
+	registry = make(map[int]RegistryEntry)
+	data, err := os.ReadFile(registryFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取用户登记表失败: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &registry); err != nil {
+		log.Printf("解析用户登记表失败: %v", err)
+	}
+}
+
+// 记录用户ID的抓取结果
+func recordOutcome(userID int, outcome string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	loadRegistryLocked()
+	registry[userID] = RegistryEntry{
+		Outcome:   outcome,
+		CheckedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+}
+
+// 已知无效且未到重新检查时间的ID应跳过
+func shouldSkipUser(userID int) (RegistryEntry, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	loadRegistryLocked()
+	entry, exists := registry[userID]
+	if !exists || entry.Outcome == outcomeOK {
+		return entry, false
+	}
+	checkedAt, err := time.ParseInLocation("2006-01-02 15:04:05", entry.CheckedAt, time.Local)
+	if err != nil {
+		return entry, false
+	}
+	return entry, time.Since(checkedAt) < time.Duration(registryRecheckDays)*24*time.Hour
+}
+
+func saveRegistry() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if !registryLoaded {
+		return
+	}
+	data, err := json.Marshal(registry)
+	if err != nil {
+		log.Printf("用户登记表序列化失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(registryFile(), data, 0644); err != nil {
+		log.Printf("保存用户登记表失败: %v", err)
+	}
+}
+
+// 根据抓取状态判断结果：所有类型都返回404为不存在，401/403为私密，全部成功但没有收藏为空
+func userOutcome(user JsonUserFile) string {
+	notFound, private := 0, 0
+	for _, status := range user.FetchStatus {
+		switch status.StatusCode {
+		case 404:
+			notFound++
+		case 401, 403:
+			private++
+		}
+	}
+	switch {
+	case notFound == len(collectionTypeNames):
+		return outcomeNotFound
+	case private == len(collectionTypeNames):
+		return outcomePrivate
+	case isEmptyUserData(user) && user.isComplete():
+		return outcomeEmpty
+	default:
+		return outcomeOK
+	}
+}
@@ -0,0 +1,46 @@
+package user
+
+import (
+	"fmt"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- ID表达式选择器 -------------------------
+
+func init() {
+	RegisterSelector(ScopeUser, "users-all", func(op, arg string) ([]int, error) { return getAllUserIDs() })
+	RegisterSelector(ScopeUser, "users-empty", func(op, arg string) ([]int, error) { return getUsersWithEmptyData() })
+	RegisterSelector(ScopeUser, "users-stale", selectStaleUsers)
+}
+
+// users-stale>7d：超过指定时长未抓取的用户，没有抓取时间的用户视为过期
+func selectStaleUsers(op, arg string) ([]int, error) {
+	if op != ">" {
+		return nil, fmt.Errorf("用法: users-stale>7d")
+	}
+	age, err := ParseAge(arg)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-age)
+
+	existingIDs, err := readExistingUserIDs()
+	if err != nil {
+		return nil, err
+	}
+	catchTimes, err := getUserCatchTimes()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for id := range existingIDs {
+		catchTime, err := time.ParseInLocation("2006-01-02 15:04:05", catchTimes[id], time.Local)
+		if err != nil || catchTime.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
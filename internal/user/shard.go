@@ -0,0 +1,381 @@
+package user
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 分片目录与用户索引 -------------------------
+// 用户文件按ID分片存放：users/{id/100000}/{id/1000%100}/{id}.json，每个目录最多一千个文件。
+// 旧版平铺目录（users/{id}.json）仍可读取，可通过 bgm-catch migrate-users 迁移。
+// 分片布局下维护 user_index.jsonl，每次写入或删除用户时追加一行，同一用户以最后一行为准，
+// 列出用户、按抓取时间或是否为空筛选时只读索引，不必打开每个用户文件
+
+type UserSummary struct {
+	UserID    int    `json:"user_id"`
+	ProjectID int    `json:"project_id"`
+	CatchTime string `json:"catch_time,omitempty"`
+	Counts    [5]int `json:"counts"` // 各收藏类型的条目数，顺序同 collectionTypeNames
+	Empty     bool   `json:"empty"`
+	Complete  bool   `json:"complete"`
+	Deleted   bool   `json:"deleted,omitempty"` // 索引中表示该用户已删除
+}
+
+func summarizeUser(user JsonUserFile) UserSummary {
+	summary := UserSummary{
+		UserID:    user.UserID,
+		ProjectID: user.ProjectID,
+		CatchTime: user.CatchTime,
+		Empty:     isEmptyUserData(user),
+		Complete:  user.isComplete(),
+	}
+	for ct := 1; ct <= 5; ct++ {
+		summary.Counts[ct-1] = len(*user.collectionList(ct))
+	}
+	return summary
+}
+
+func shardedUserPath(userID int) string {
+	return filepath.Join(usersDir(), strconv.Itoa(userID/100000), strconv.Itoa(userID/1000%100), fmt.Sprintf("%d.json", userID))
+}
+
+func flatUserPath(userID int) string {
+	return filepath.Join(usersDir(), fmt.Sprintf("%d.json", userID))
+}
+
+// 从文件名解析用户ID，压缩的用户文件（.json.gz/.json.zst）同样识别，不是用户文件时返回 false
+func userIDFromFileName(name string) (int, bool) {
+	name, _ = SplitCompressionExt(name)
+	idStr, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(idStr)
+	return id, err == nil
+}
+
+var (
+	layoutMu      sync.Mutex
+	layoutChecked bool
+	layoutSharded bool
+	layoutMixed   bool // 平铺文件与分片目录同时存在，例如迁移中断
+)
+
+// 用户目录顶层存在用户文件时为旧版平铺布局，否则（包括目录不存在）使用分片布局。
+// 平铺布局下若同时存在分片目录则为混合布局，读取和列出用户时两种布局都要查找
+func shardedLayout() bool {
+	layoutMu.Lock()
+	defer layoutMu.Unlock()
+	checkLayoutLocked()
+	return layoutSharded
+}
+
+func mixedLayout() bool {
+	layoutMu.Lock()
+	defer layoutMu.Unlock()
+	checkLayoutLocked()
+	return layoutMixed
+}
+
+func checkLayoutLocked() {
+	if layoutChecked {
+		return
+	}
+	layoutChecked = true
+	layoutSharded, layoutMixed = true, false
+
+	dir, err := os.Open(usersDir())
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	hasFlat, hasShards := false, false
+	for !(hasFlat && hasShards) {
+		entries, err := dir.ReadDir(256)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				if _, err := strconv.Atoi(entry.Name()); err == nil {
+					hasShards = true
+				}
+			} else if _, ok := userIDFromFileName(entry.Name()); ok {
+				hasFlat = true
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if !hasFlat {
+		return
+	}
+	layoutSharded, layoutMixed = false, hasShards
+	if layoutMixed {
+		log.Printf("用户目录同时存在平铺文件和分片目录（迁移可能中断），请运行 bgm-catch migrate-users 完成迁移")
+	} else {
+		log.Printf("用户目录为旧版平铺布局，建议运行 bgm-catch migrate-users 迁移到分片布局")
+	}
+}
+
+func setShardedLayout(sharded bool) {
+	layoutMu.Lock()
+	defer layoutMu.Unlock()
+	layoutChecked = true
+	layoutSharded, layoutMixed = sharded, false
+}
+
+// 遍历分片目录中的用户文件，顶层的平铺文件不在其中
+func walkShardedUsers(fn func(userID int, path string) error) error {
+	return filepath.WalkDir(usersDir(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == usersDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		userID, ok := userIDFromFileName(entry.Name())
+		if base, _ := SplitCompressionExt(path); !ok || base != shardedUserPath(userID) {
+			return nil
+		}
+		return fn(userID, path)
+	})
+}
+
+// ------------------------- 索引读写 -------------------------
+
+var (
+	userIndex       map[int]UserSummary
+	userIndexMu     sync.Mutex
+	userIndexLoaded bool
+	userIndexLines  int // 索引文件当前行数，远多于用户数时压缩
+)
+
+func loadUserIndexLocked() error {
+	if userIndexLoaded {
+		return nil
+	}
+	file, err := os.Open(userIndexFile())
+	if os.IsNotExist(err) {
+		// 索引缺失（例如手动复制了用户目录）时扫描分片目录重建
+		if err := rebuildUserIndexLocked(nil); err != nil {
+			return err
+		}
+		userIndexLoaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	userIndex = make(map[int]UserSummary)
+	userIndexLines = 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var summary UserSummary
+		if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+			continue // 跳过写入中断留下的残行
+		}
+		userIndexLines++
+		if summary.Deleted {
+			delete(userIndex, summary.UserID)
+		} else {
+			userIndex[summary.UserID] = summary
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	userIndexLoaded = true
+
+	if userIndexLines > 2*len(userIndex)+1000 {
+		return writeUserIndexLocked()
+	}
+	return nil
+}
+
+// 逐行读取索引文件，不加载到内存；跳过写入中断留下的残行，索引不存在时返回 os.ErrNotExist
+func eachUserIndexLine(fn func(UserSummary) error) error {
+	file, err := os.Open(userIndexFile())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var summary UserSummary
+		if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+			continue
+		}
+		if err := fn(summary); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// 追加一条索引记录
+func appendUserIndex(summary UserSummary) error {
+	userIndexMu.Lock()
+	defer userIndexMu.Unlock()
+	if err := loadUserIndexLocked(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(userIndexFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	userIndexLines++
+	if summary.Deleted {
+		delete(userIndex, summary.UserID)
+	} else {
+		userIndex[summary.UserID] = summary
+	}
+	return nil
+}
+
+func readUserIndex() (map[int]UserSummary, error) {
+	userIndexMu.Lock()
+	defer userIndexMu.Unlock()
+	if err := loadUserIndexLocked(); err != nil {
+		return nil, err
+	}
+	summaries := make(map[int]UserSummary, len(userIndex))
+	for id, summary := range userIndex {
+		summaries[id] = summary
+	}
+	return summaries, nil
+}
+
+// 按用户ID顺序重写索引，每个用户一行
+func writeUserIndexLocked() error {
+	ids := make([]int, 0, len(userIndex))
+	for id := range userIndex {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	tmpPath := userIndexFile() + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, id := range ids {
+		data, _ := json.Marshal(userIndex[id])
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	userIndexLines = len(ids)
+	return os.Rename(tmpPath, userIndexFile())
+}
+
+// 扫描分片目录重建索引，known 中已有的用户不再重复读取文件
+func rebuildUserIndexLocked(known map[int]UserSummary) error {
+	userIndex = make(map[int]UserSummary)
+	count := 0
+	err := walkShardedUsers(func(userID int, path string) error {
+		if summary, exists := known[userID]; exists {
+			userIndex[userID] = summary
+			return nil
+		}
+		user, err := readUserFile(path)
+		if err != nil {
+			log.Printf("读取用户文件 %s 失败，未加入索引: %v", path, err)
+			return nil
+		}
+		userIndex[userID] = summarizeUser(user)
+		if count++; count%10000 == 0 {
+			log.Printf("重建用户索引: 已读取 %d 个用户文件", count)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(userIndex) == 0 {
+		userIndexLines = 0
+		return nil // 没有用户时不生成空索引
+	}
+	return writeUserIndexLocked()
+}
+
+// ------------------------- 迁移 -------------------------
+
+// 把平铺布局的用户文件移入分片目录并重建索引；已是分片布局时只重建索引。
+// 中途中断后重新运行即可继续
+func MigrateUserLayout() error {
+	entries, err := os.ReadDir(usersDir())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	migrated := make(map[int]UserSummary)
+	for _, entry := range entries {
+		userID, ok := userIDFromFileName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		src := filepath.Join(usersDir(), entry.Name())
+		user, err := readUserFile(src)
+		if err != nil {
+			return fmt.Errorf("读取用户文件 %s 失败: %v", src, err)
+		}
+		_, method := SplitCompressionExt(src)
+		dst := WithCompressionExt(shardedUserPath(userID), method) // 保留原有的压缩方式
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("移动用户文件 %s 失败: %v", src, err)
+		}
+		// 混合布局下分片目录中可能已有该用户的旧文件，以平铺文件为准
+		if err := RemoveOtherVariants(shardedUserPath(userID), dst); err != nil {
+			return err
+		}
+		migrated[userID] = summarizeUser(user)
+		if len(migrated)%10000 == 0 {
+			log.Printf("已迁移 %d 个用户文件", len(migrated))
+		}
+	}
+	setShardedLayout(true)
+
+	userIndexMu.Lock()
+	defer userIndexMu.Unlock()
+	if err := rebuildUserIndexLocked(migrated); err != nil {
+		return fmt.Errorf("重建用户索引失败: %v", err)
+	}
+	userIndexLoaded = true
+	fmt.Printf("迁移完成：移动 %d 个用户文件，索引中共 %d 个用户\n", len(migrated), len(userIndex))
+	return nil
+}
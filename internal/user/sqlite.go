@@ -0,0 +1,400 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- SQLite读写 -------------------------
+// 每个用户一行，收藏按类型和原有顺序存入 user_collections，保存单个用户时只替换该用户的数据
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func readUserDB(userID int) (JsonUserFile, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return JsonUserFile{}, err
+	}
+
+	user := JsonUserFile{UserID: userID}
+	var fetchStatus string
+	err = conn.QueryRow(`SELECT project_id, name, catch_time, full_sync_time, fetch_status FROM users WHERE user_id = ?`, userID).
+		Scan(&user.ProjectID, &user.UserName, &user.CatchTime, &user.FullSyncTime, &fetchStatus)
+	if err == sql.ErrNoRows {
+		return user, os.ErrNotExist // 与用户文件不存在时的行为一致
+	}
+	if err != nil {
+		return user, err
+	}
+	if fetchStatus != "" {
+		json.Unmarshal([]byte(fetchStatus), &user.FetchStatus)
+	}
+	for ct := 1; ct <= 5; ct++ {
+		*user.collectionList(ct) = []Subject{}
+	}
+
+	rows, err := conn.Query(`SELECT subject_id, project_id, type, rate, comment, tags, updated_at, ep_status, vol_status, private, subject
+		FROM user_collections WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		return user, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			s                    Subject
+			private              int
+			tags, subjectSummary string
+		)
+		if err := rows.Scan(&s.SubjectID, &s.ProjectID, &s.Type, &s.Rate, &s.Comment, &tags, &s.UpdatedAt,
+			&s.EpStatus, &s.VolStatus, &private, &subjectSummary); err != nil {
+			return user, err
+		}
+		s.Private = private == 1
+		json.Unmarshal([]byte(tags), &s.Tags)
+		if subjectSummary != "" {
+			s.Info = &SlimSubject{}
+			json.Unmarshal([]byte(subjectSummary), s.Info)
+		}
+		if s.Type >= 1 && s.Type <= 5 {
+			list := user.collectionList(s.Type)
+			*list = append(*list, s)
+		}
+	}
+	return user, rows.Err()
+}
+
+func writeUserDB(user JsonUserFile) error {
+	return WithTx(func(tx *sql.Tx) error {
+		fetchStatus := ""
+		if user.FetchStatus != nil {
+			data, _ := json.Marshal(user.FetchStatus)
+			fetchStatus = string(data)
+		}
+		if _, err := tx.Exec(`INSERT INTO users (user_id, project_id, name, catch_time, full_sync_time, fetch_status) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET project_id = excluded.project_id, name = excluded.name, catch_time = excluded.catch_time,
+			full_sync_time = excluded.full_sync_time, fetch_status = excluded.fetch_status`,
+			user.UserID, user.ProjectID, user.UserName, user.CatchTime, user.FullSyncTime, fetchStatus); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM user_collections WHERE user_id = ?`, user.UserID); err != nil {
+			return err
+		}
+
+		insert, err := tx.Prepare(`INSERT INTO user_collections (user_id, position, subject_id, project_id, type, rate, comment, tags,
+			updated_at, ep_status, vol_status, private, subject) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+
+		position := 0
+		for ct := 1; ct <= 5; ct++ {
+			for _, s := range *user.collectionList(ct) {
+				if s.Type == 0 {
+					s.Type = ct // 旧数据没有记录收藏类型
+				}
+				tags, _ := json.Marshal(s.Tags)
+				subjectSummary := ""
+				if s.Info != nil {
+					data, _ := json.Marshal(s.Info)
+					subjectSummary = string(data)
+				}
+				if _, err := insert.Exec(user.UserID, position, s.SubjectID, s.ProjectID, s.Type, s.Rate, s.Comment, string(tags),
+					s.UpdatedAt, s.EpStatus, s.VolStatus, boolInt(s.Private), subjectSummary); err != nil {
+					return err
+				}
+				position++
+			}
+		}
+		return nil
+	})
+}
+
+func deleteUserDB(userID int) error {
+	return WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM user_collections WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM users WHERE user_id = ?`, userID)
+		return err
+	})
+}
+
+func readUserIDsDB() (map[int]struct{}, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(`SELECT user_id FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]struct{})
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = struct{}{}
+	}
+	return ids, rows.Err()
+}
+
+func eachUserKeyDB(fn func(userID, projectID int) error) error {
+	conn, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	rows, err := conn.Query(`SELECT user_id, project_id FROM users`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, projectID int
+		if err := rows.Scan(&userID, &projectID); err != nil {
+			return err
+		}
+		if err := fn(userID, projectID); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// 各用户的概要信息，条目数由 user_collections 按类型统计
+func readSummariesDB() (map[int]UserSummary, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(`SELECT user_id, project_id, catch_time, fetch_status FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[int]UserSummary)
+	for rows.Next() {
+		var (
+			user        JsonUserFile
+			fetchStatus string
+		)
+		if err := rows.Scan(&user.UserID, &user.ProjectID, &user.CatchTime, &fetchStatus); err != nil {
+			return nil, err
+		}
+		if fetchStatus != "" {
+			json.Unmarshal([]byte(fetchStatus), &user.FetchStatus)
+		}
+		summaries[user.UserID] = summarizeUser(user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts, err := conn.Query(`SELECT user_id, type, COUNT(*) FROM user_collections GROUP BY user_id, type`)
+	if err != nil {
+		return nil, err
+	}
+	defer counts.Close()
+	for counts.Next() {
+		var userID, ct, count int
+		if err := counts.Scan(&userID, &ct, &count); err != nil {
+			return nil, err
+		}
+		summary, exists := summaries[userID]
+		if !exists || ct < 1 || ct > 5 {
+			continue
+		}
+		summary.Counts[ct-1] = count
+		summary.Empty = false
+		summaries[userID] = summary
+	}
+	return summaries, counts.Err()
+}
+
+func readAnimeMapDB() (map[int]int, error) {
+	conn, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(`SELECT project_id, original_id FROM anime_remap`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	idMap := make(map[int]int)
+	for rows.Next() {
+		var projectID, originalID int
+		if err := rows.Scan(&projectID, &originalID); err != nil {
+			return nil, err
+		}
+		idMap[originalID] = projectID
+	}
+	return idMap, rows.Err()
+}
+
+func writeUserRemapDB(users []JsonUserFile) error {
+	return WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM user_remap`); err != nil {
+			return err
+		}
+		insert, err := tx.Prepare(`INSERT INTO user_remap (project_id, user_id, user_name) VALUES (?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+		for _, u := range users {
+			if _, err := insert.Exec(u.ProjectID, u.UserID, u.UserName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func deleteUserRemapDB(userID int) error {
+	conn, err := OpenDB()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(`DELETE FROM user_remap WHERE user_id = ?`, userID)
+	return err
+}
+
+// ------------------------- SQLite实现 -------------------------
+
+type sqliteStore struct{}
+
+func (sqliteStore) LoadUser(userID int) (JsonUserFile, error) { return readUserDB(userID) }
+func (sqliteStore) SaveUser(user JsonUserFile) error          { return writeUserDB(user) }
+func (sqliteStore) DeleteUser(userID int) error               { return deleteUserDB(userID) }
+func (sqliteStore) UserIDs() (map[int]struct{}, error)        { return readUserIDsDB() }
+func (sqliteStore) Summaries() (map[int]UserSummary, error)   { return readSummariesDB() }
+func (sqliteStore) LoadAnimeMap() (map[int]int, error)        { return readAnimeMapDB() }
+
+func (s sqliteStore) EachUser(fn func(JsonUserFile) error) error {
+	return eachUserByID(s, fn)
+}
+
+func (sqliteStore) EachUserKey(fn func(userID, projectID int) error) error {
+	return eachUserKeyDB(fn)
+}
+
+// 映射表同时写入数据库和CSV，CSV便于外部使用
+func (sqliteStore) SaveUserMap(users []JsonUserFile) error {
+	if err := writeUserRemapDB(users); err != nil {
+		return err
+	}
+	return writeUserMapCSV(users)
+}
+
+func (sqliteStore) DeleteUserMapEntry(userID int) error {
+	if err := deleteUserRemapDB(userID); err != nil {
+		return err
+	}
+	return removeCSVRows(userMapFile(), 1, userID)
+}
+
+// ------------------------- JSON与数据库互相转换 -------------------------
+
+// 逐个复制用户数据，返回复制的用户数
+func copyUsers(from, to Store) (int, error) {
+	ids, err := from.UserIDs()
+	if err != nil {
+		return 0, err
+	}
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	for _, id := range sorted {
+		user, err := from.LoadUser(id)
+		if err != nil {
+			return 0, fmt.Errorf("读取用户 %d 失败: %v", id, err)
+		}
+		if err := to.SaveUser(user); err != nil {
+			return 0, fmt.Errorf("写入用户 %d 失败: %v", id, err)
+		}
+	}
+	return len(sorted), nil
+}
+
+// 把数据目录下的用户文件和用户映射表导入数据库
+func ImportDB() error {
+	count, err := copyUsers(fsStore{}, sqliteStore{})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Printf("已导入用户 %d 个\n", count)
+
+	users, err := readUserRemapCSV()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := writeUserRemapDB(users); err != nil {
+			return fmt.Errorf("导入用户映射表失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// 把数据库中的用户导出为数据目录下的用户文件
+func ExportDB() error {
+	count, err := copyUsers(sqliteStore{}, fsStore{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已导出用户 %d 个\n", count)
+	return nil
+}
+
+func readUserRemapCSV() ([]JsonUserFile, error) {
+	file, err := os.Open(userMapFile())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	if _, err := reader.Read(); err != nil { // 跳过标题行
+		return nil, err
+	}
+	var users []JsonUserFile
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			continue
+		}
+		projectID, _ := strconv.Atoi(record[0])
+		userID, _ := strconv.Atoi(record[1])
+		users = append(users, JsonUserFile{ProjectID: projectID, UserID: userID, UserName: record[2]})
+	}
+	return users, nil
+}
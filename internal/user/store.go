@@ -0,0 +1,284 @@
+package user
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 存储接口 -------------------------
+// 用户数据、条目映射表和用户映射表的读写都经过 Store，
+// 默认按 STORAGE 选择文件或SQLite实现，测试时可通过 SetStore 换成内存实现
+
+type Store interface {
+	LoadUser(userID int) (JsonUserFile, error) // 不存在时返回 os.ErrNotExist
+	SaveUser(user JsonUserFile) error
+	DeleteUser(userID int) error
+	UserIDs() (map[int]struct{}, error)
+	Summaries() (map[int]UserSummary, error) // 列出和筛选用户时使用，不必读取完整数据
+	// 逐个提供用户ID和 project_id，不在内存中汇总，合并大量用户时使用；
+	// 可能包含重复或过期的记录，调用方以 LoadUser 读出的数据为准
+	EachUserKey(fn func(userID, projectID int) error) error
+	EachUser(fn func(JsonUserFile) error) error // 逐个读取用户数据，顺序不定，fn 返回错误时停止
+
+	LoadAnimeMap() (map[int]int, error) // original_id -> project_id
+	SaveUserMap(users []JsonUserFile) error
+	DeleteUserMapEntry(userID int) error
+}
+
+var (
+	activeStore Store
+	storeMu     sync.Mutex
+)
+
+// 替换当前使用的存储实现
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	activeStore = s
+}
+
+func currentStore() Store {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if activeStore == nil {
+		if UseSQLite() {
+			activeStore = sqliteStore{}
+		} else {
+			activeStore = fsStore{}
+		}
+	}
+	return activeStore
+}
+
+// ------------------------- 读写入口 -------------------------
+
+func loadAnimeMap() error {
+	idMap, err := currentStore().LoadAnimeMap()
+	if err != nil {
+		return err
+	}
+	animeIDMap = idMap
+	return nil
+}
+
+func saveUserData(user JsonUserFile) error {
+	user.CatchTime = time.Now().Format("2006-01-02 15:04:05")
+	return writeUserData(user)
+}
+
+// 按原样写入，不修改抓取时间
+func writeUserData(user JsonUserFile) error {
+	return currentStore().SaveUser(user)
+}
+
+func readUserData(userID int) (JsonUserFile, error) {
+	return currentStore().LoadUser(userID)
+}
+
+func deleteUserData(userID int) error {
+	return currentStore().DeleteUser(userID)
+}
+
+func readExistingUserIDs() (map[int]struct{}, error) {
+	return currentStore().UserIDs()
+}
+
+// 按用户ID逐个读取，文件和SQLite实现共用
+func eachUserByID(s Store, fn func(JsonUserFile) error) error {
+	ids, err := s.UserIDs()
+	if err != nil {
+		return err
+	}
+	for userID := range ids {
+		user, err := s.LoadUser(userID)
+		if err != nil {
+			return fmt.Errorf("读取用户 %d 失败: %v", userID, err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readUserSummaries() (map[int]UserSummary, error) {
+	return currentStore().Summaries()
+}
+
+func getUserCatchTimes() (map[int]string, error) {
+	summaries, err := readUserSummaries()
+	if err != nil {
+		return nil, err
+	}
+	catchTimes := make(map[int]string)
+	for id, summary := range summaries {
+		if summary.CatchTime != "" {
+			catchTimes[id] = summary.CatchTime
+		}
+	}
+	return catchTimes, nil
+}
+
+// ------------------------- 内存实现 -------------------------
+
+type memStore struct {
+	mu       sync.Mutex
+	users    map[int]JsonUserFile
+	animeMap map[int]int
+	userMap  []JsonUserFile
+}
+
+// 内存存储，animeMap 为条目映射表（original_id -> project_id），可为空
+func NewMemStore(animeMap map[int]int) Store {
+	s := &memStore{users: make(map[int]JsonUserFile), animeMap: make(map[int]int)}
+	for originalID, projectID := range animeMap {
+		s.animeMap[originalID] = projectID
+	}
+	return s
+}
+
+func (s *memStore) LoadUser(userID int) (JsonUserFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, exists := s.users[userID]
+	if !exists {
+		return JsonUserFile{}, fmt.Errorf("用户 %d: %w", userID, os.ErrNotExist)
+	}
+	return cloneUser(user), nil
+}
+
+func (s *memStore) SaveUser(user JsonUserFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.UserID] = cloneUser(user)
+	return nil
+}
+
+// 深拷贝用户数据，调用方修改读出或已保存的数据时不影响存储中的内容
+func cloneUser(user JsonUserFile) JsonUserFile {
+	for ct := 1; ct <= 5; ct++ {
+		list := user.collectionList(ct)
+		if *list == nil {
+			continue
+		}
+		cloned := make([]Subject, len(*list))
+		for i, subject := range *list {
+			if subject.Tags != nil {
+				subject.Tags = append([]string{}, subject.Tags...)
+			}
+			if subject.Info != nil {
+				info := *subject.Info
+				subject.Info = &info
+			}
+			cloned[i] = subject
+		}
+		*list = cloned
+	}
+	if user.FetchStatus != nil {
+		status := make(map[string]TypeStatus, len(user.FetchStatus))
+		for name, s := range user.FetchStatus {
+			status[name] = s
+		}
+		user.FetchStatus = status
+	}
+	return user
+}
+
+func (s *memStore) DeleteUser(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[userID]; !exists {
+		return fmt.Errorf("用户 %d: %w", userID, os.ErrNotExist)
+	}
+	delete(s.users, userID)
+	return nil
+}
+
+func (s *memStore) UserIDs() (map[int]struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make(map[int]struct{}, len(s.users))
+	for id := range s.users {
+		ids[id] = struct{}{}
+	}
+	return ids, nil
+}
+
+func (s *memStore) Summaries() (map[int]UserSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summaries := make(map[int]UserSummary, len(s.users))
+	for id, user := range s.users {
+		summaries[id] = summarizeUser(user)
+	}
+	return summaries, nil
+}
+
+// 先复制再回调，fn 中可以读写存储
+func (s *memStore) EachUser(fn func(JsonUserFile) error) error {
+	s.mu.Lock()
+	users := make([]JsonUserFile, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, cloneUser(user))
+	}
+	s.mu.Unlock()
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 先复制再回调，fn 中可以读取存储
+func (s *memStore) EachUserKey(fn func(userID, projectID int) error) error {
+	s.mu.Lock()
+	keys := make([][2]int, 0, len(s.users))
+	for id, user := range s.users {
+		keys = append(keys, [2]int{id, user.ProjectID})
+	}
+	s.mu.Unlock()
+	for _, key := range keys {
+		if err := fn(key[0], key[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) LoadAnimeMap() (map[int]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idMap := make(map[int]int, len(s.animeMap))
+	for originalID, projectID := range s.animeMap {
+		idMap[originalID] = projectID
+	}
+	return idMap, nil
+}
+
+func (s *memStore) SaveUserMap(users []JsonUserFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userMap = make([]JsonUserFile, len(users))
+	copy(s.userMap, users)
+	sort.Slice(s.userMap, func(i, j int) bool { return s.userMap[i].ProjectID < s.userMap[j].ProjectID })
+	return nil
+}
+
+func (s *memStore) DeleteUserMapEntry(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.userMap[:0]
+	for _, u := range s.userMap {
+		if u.UserID != userID {
+			kept = append(kept, u)
+		}
+	}
+	s.userMap = kept
+	return nil
+}
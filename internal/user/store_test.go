@@ -0,0 +1,294 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "bgm-catch/internal/basic"
+)
+
+// 使用临时数据目录，并重置按数据目录缓存的布局和索引状态
+func useTempDataRoot(t *testing.T) string {
+	t.Helper()
+	t.Setenv("DATA_DIR", DataRoot()) // 结束时恢复环境变量
+	previous := DataRoot()
+	dir := t.TempDir()
+	SetDataRoot(dir)
+	resetLayoutState()
+	t.Cleanup(func() {
+		SetDataRoot(previous)
+		resetLayoutState()
+		SetStore(nil)
+	})
+	return dir
+}
+
+func resetLayoutState() {
+	layoutMu.Lock()
+	layoutChecked = false
+	layoutMu.Unlock()
+	userIndexMu.Lock()
+	userIndex, userIndexLoaded, userIndexLines = nil, false, 0
+	userIndexMu.Unlock()
+}
+
+func testUser(id, projectID int) JsonUserFile {
+	return JsonUserFile{
+		UserID:    id,
+		ProjectID: projectID,
+		UserName:  "user",
+		Wish:      []Subject{{SubjectID: 1, Type: 1, Tags: []string{"a"}, Info: &SlimSubject{ID: 1, Name: "x"}}},
+		Collect:   []Subject{{SubjectID: 2, Type: 2, Rate: 8}, {SubjectID: 3, Type: 2}},
+		CatchTime: "2026-01-01 00:00:00",
+		FetchStatus: map[string]TypeStatus{
+			"wish": {Status: fetchOK}, "collect": {Status: fetchOK},
+		},
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name  string
+		setup func(t *testing.T) Store
+	}{
+		{"内存", func(t *testing.T) Store { return NewMemStore(nil) }},
+		{"文件", func(t *testing.T) Store { useTempDataRoot(t); return fsStore{} }},
+		{"文件gzip", func(t *testing.T) Store { useTempDataRoot(t); t.Setenv("COMPRESS", "users:gzip"); return fsStore{} }},
+		{"文件zstd", func(t *testing.T) Store { useTempDataRoot(t); t.Setenv("COMPRESS", "zstd"); return fsStore{} }},
+	}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.setup(t)
+
+			if _, err := store.LoadUser(1); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("LoadUser() 不存在的用户 error = %v, want os.ErrNotExist", err)
+			}
+
+			empty := JsonUserFile{UserID: 2, ProjectID: 2, FetchStatus: map[string]TypeStatus{"wish": {Status: fetchFailed}}}
+			for _, user := range []JsonUserFile{testUser(1, 1), empty, testUser(100123, 3)} {
+				if err := store.SaveUser(user); err != nil {
+					t.Fatalf("SaveUser(%d) error = %v", user.UserID, err)
+				}
+			}
+
+			got, err := store.LoadUser(1)
+			if err != nil {
+				t.Fatalf("LoadUser() error = %v", err)
+			}
+			if want := testUser(1, 1); !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadUser() = %+v, want %+v", got, want)
+			}
+
+			ids, err := store.UserIDs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[int]struct{}{1: {}, 2: {}, 100123: {}}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("UserIDs() = %v, want %v", ids, want)
+			}
+
+			summaries, err := store.Summaries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSummary := UserSummary{UserID: 1, ProjectID: 1, CatchTime: "2026-01-01 00:00:00", Counts: [5]int{1, 2}, Complete: true}
+			if summaries[1] != wantSummary {
+				t.Errorf("Summaries()[1] = %+v, want %+v", summaries[1], wantSummary)
+			}
+			if s := summaries[2]; !s.Empty || s.Complete {
+				t.Errorf("Summaries()[2] = %+v, want Empty 且未完整", s)
+			}
+
+			count := 0
+			if err := store.EachUser(func(JsonUserFile) error { count++; return nil }); err != nil || count != 3 {
+				t.Errorf("EachUser() 读取 %d 个用户, error = %v, want 3", count, err)
+			}
+
+			if err := store.DeleteUser(2); err != nil {
+				t.Fatalf("DeleteUser() error = %v", err)
+			}
+			if _, err := store.LoadUser(2); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("删除后 LoadUser() error = %v, want os.ErrNotExist", err)
+			}
+			if ids, _ := store.UserIDs(); len(ids) != 2 {
+				t.Errorf("删除后 UserIDs() = %v", ids)
+			}
+			if summaries, _ := store.Summaries(); len(summaries) != 2 {
+				t.Errorf("删除后 Summaries() = %v", summaries)
+			}
+		})
+	}
+}
+
+// 内存存储保存和读取时复制数据，调用方之后的修改不影响存储
+func TestMemStoreCopies(t *testing.T) {
+	store := NewMemStore(map[int]int{10: 1})
+
+	user := testUser(1, 1)
+	if err := store.SaveUser(user); err != nil {
+		t.Fatal(err)
+	}
+	user.Wish[0].Tags[0] = "changed"
+	user.Wish[0].Info.Name = "changed"
+	user.Collect[0].Rate = 1
+	user.FetchStatus["wish"] = TypeStatus{Status: fetchFailed}
+
+	loaded, _ := store.LoadUser(1)
+	if want := testUser(1, 1); !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("保存后修改原数据影响了存储: %+v", loaded)
+	}
+	loaded.Collect = append(loaded.Collect[:0], Subject{SubjectID: 99})
+	loaded.Wish[0].Tags[0] = "changed"
+	if again, _ := store.LoadUser(1); !reflect.DeepEqual(again, testUser(1, 1)) {
+		t.Errorf("修改读出的数据影响了存储: %+v", again)
+	}
+
+	animeMap, _ := store.LoadAnimeMap()
+	animeMap[10] = 99
+	if again, _ := store.LoadAnimeMap(); again[10] != 1 {
+		t.Errorf("修改读出的映射表影响了存储: %v", again)
+	}
+}
+
+// 通过 SetStore 替换存储后，读写入口使用替换的实现
+func TestStoreHelpers(t *testing.T) {
+	SetStore(NewMemStore(map[int]int{10: 1, 20: 2}))
+	defer SetStore(nil)
+
+	incomplete := testUser(3, 3)
+	incomplete.FetchStatus["collect"] = TypeStatus{Status: fetchPartial}
+	for _, user := range []JsonUserFile{testUser(1, 1), {UserID: 2, ProjectID: 2}, incomplete} {
+		if err := writeUserData(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveUserData(JsonUserFile{UserID: 4, ProjectID: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadAnimeMap(); err != nil || !reflect.DeepEqual(animeIDMap, map[int]int{10: 1, 20: 2}) {
+		t.Errorf("loadAnimeMap() = %v, %v", animeIDMap, err)
+	}
+
+	catchTimes, err := getUserCatchTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catchTimes[1] != "2026-01-01 00:00:00" || catchTimes[4] == "" {
+		t.Errorf("getUserCatchTimes() = %v，saveUserData 应设置抓取时间", catchTimes)
+	}
+	if _, exists := catchTimes[2]; exists {
+		t.Errorf("getUserCatchTimes() 不应包含没有抓取时间的用户: %v", catchTimes)
+	}
+
+	emptyIDs, err := getUsersWithEmptyData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs(emptyIDs, []int{2, 4}) {
+		t.Errorf("getUsersWithEmptyData() = %v, want [2 4]", emptyIDs)
+	}
+
+	incompleteIDs, err := getIncompleteUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs(incompleteIDs, []int{3}) {
+		t.Errorf("getIncompleteUsers() = %v, want [3]", incompleteIDs)
+	}
+
+	allIDs, err := getAllUserIDs()
+	if err != nil || !sameIDs(allIDs, []int{1, 2, 3, 4}) {
+		t.Errorf("getAllUserIDs() = %v, %v", allIDs, err)
+	}
+}
+
+// 迁移中断后平铺文件与分片目录并存，两种布局中的用户都能读取和列出
+func TestMixedLayout(t *testing.T) {
+	useTempDataRoot(t)
+	write := func(path string, user JsonUserFile) {
+		t.Helper()
+		data, _ := json.Marshal(user)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(flatUserPath(1), testUser(1, 1))
+	write(shardedUserPath(100123), testUser(100123, 2))
+	write(shardedUserPath(5), testUser(5, 3)) // 平铺目录中也有一份较新的数据
+	newer := testUser(5, 3)
+	newer.UserName = "newer"
+	write(flatUserPath(5), newer)
+
+	store := fsStore{}
+	if shardedLayout() || !mixedLayout() {
+		t.Fatalf("shardedLayout() = %v, mixedLayout() = %v, want false, true", shardedLayout(), mixedLayout())
+	}
+
+	ids, err := store.UserIDs()
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("UserIDs() = %v, %v, want 3 users", ids, err)
+	}
+	for _, id := range []int{1, 5, 100123} {
+		if _, exists := ids[id]; !exists {
+			t.Errorf("UserIDs() 缺少用户 %d", id)
+		}
+	}
+	if user, err := store.LoadUser(100123); err != nil || user.ProjectID != 2 {
+		t.Errorf("LoadUser(100123) = %+v, %v", user, err)
+	}
+	if user, err := store.LoadUser(5); err != nil || user.UserName != "newer" {
+		t.Errorf("LoadUser(5) = %+v, %v, want 平铺目录中的数据", user, err)
+	}
+	summaries, err := store.Summaries()
+	if err != nil || len(summaries) != 3 || summaries[100123].ProjectID != 2 {
+		t.Errorf("Summaries() = %v, %v", summaries, err)
+	}
+
+	// 保存后另一种布局中的旧文件被删除，迁移时不会留下过期数据
+	if err := store.SaveUser(newer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(shardedUserPath(5)); !os.IsNotExist(err) {
+		t.Errorf("SaveUser() 后分片目录中的旧文件仍存在: %v", err)
+	}
+	if err := store.DeleteUser(100123); err != nil {
+		t.Errorf("DeleteUser(100123) error = %v", err)
+	}
+
+	if err := MigrateUserLayout(); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = store.UserIDs()
+	if err != nil || len(ids) != 2 {
+		t.Errorf("迁移后 UserIDs() = %v, %v, want [1 5]", ids, err)
+	}
+	if user, err := store.LoadUser(5); err != nil || user.UserName != "newer" {
+		t.Errorf("迁移后 LoadUser(5) = %+v, %v", user, err)
+	}
+}
+
+// 忽略顺序比较ID列表
+func sameIDs(got, want []int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	set := make(map[int]bool, len(got))
+	for _, id := range got {
+		set[id] = true
+	}
+	for _, id := range want {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package user
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "bgm-catch/internal/basic"
+)
+
+// ------------------------- 合并文件流式读写 -------------------------
+// 合并文件支持两种格式：带缩进的JSON数组（.json）和每行一个用户的NDJSON（.ndjson/.jsonl），
+// 读写时逐个用户处理，内存占用与用户数无关
+
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// 按扩展名判断合并文件格式，忽略压缩扩展名
+func mergedFormat(path string) string {
+	path, _ = SplitCompressionExt(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return formatNDJSON
+	default:
+		return formatJSON
+	}
+}
+
+type userWriter struct {
+	w      *bufio.Writer
+	format string
+	count  int
+}
+
+func newUserWriter(w io.Writer, format string) *userWriter {
+	return &userWriter{w: bufio.NewWriter(w), format: format}
+}
+
+func (uw *userWriter) Write(user JsonUserFile) error {
+	if uw.format == formatNDJSON {
+		data, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		uw.count++
+		uw.w.Write(data)
+		return uw.w.WriteByte('\n')
+	}
+
+	// 与 json.MarshalIndent 整个数组的输出一致
+	data, err := json.MarshalIndent(user, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	if uw.count == 0 {
+		uw.w.WriteString("[\n  ")
+	} else {
+		uw.w.WriteString(",\n  ")
+	}
+	uw.count++
+	_, err = uw.w.Write(data)
+	return err
+}
+
+func (uw *userWriter) Close() error {
+	if uw.format == formatJSON {
+		if uw.count == 0 {
+			uw.w.WriteString("[]")
+		} else {
+			uw.w.WriteString("\n]")
+		}
+	}
+	return uw.w.Flush()
+}
+
+// 逐个读取合并文件中的用户，自动识别JSON数组和NDJSON
+func readUserStream(r io.Reader, fn func(JsonUserFile) error) error {
+	reader := bufio.NewReader(r)
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	for decoder.More() {
+		var user JsonUserFile
+		if err := decoder.Decode(&user); err != nil {
+			return fmt.Errorf("JSON解析失败: %v", err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\n' && b != '\r' && b != '\t' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+// 流式改写合并文件，只保留 keep 返回 true 的用户，没有变化时不改写，压缩方式保持不变
+func rewriteMergedFile(path string, keep func(JsonUserFile) bool) error {
+	input, err := OpenCompressed(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	tmpPath := filepath.Join(filepath.Dir(path), "tmp_"+filepath.Base(path)) // 保留扩展名以使用相同的压缩方式
+	output, err := CreateCompressed(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	writer := newUserWriter(output, mergedFormat(path))
+	removed := 0
+	err = readUserStream(input, func(user JsonUserFile) error {
+		if !keep(user) {
+			removed++
+			return nil
+		}
+		return writer.Write(user)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || removed == 0 {
+		return err
+	}
+	input.Close()
+	return os.Rename(tmpPath, path)
+}
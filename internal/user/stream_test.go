@@ -0,0 +1,105 @@
+package user
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "bgm-catch/internal/basic"
+)
+
+// 合并后按 project_id、user_id 排序输出，拆分回存储后内容不变
+func TestMergeAndSplit(t *testing.T) {
+	incomplete := testUser(4, 1)
+	incomplete.FetchStatus["collect"] = TypeStatus{Status: fetchFailed}
+	users := []JsonUserFile{testUser(3, 2), testUser(1, 3), testUser(2, 2), incomplete}
+
+	tests := []struct {
+		name              string
+		file              string
+		excludeIncomplete bool
+		wantOrder         []int
+	}{
+		{"gzip压缩的JSON", "user.json.gz", false, []int{4, 2, 3, 1}},
+		{"NDJSON并排除不完整用户", "user.ndjson", true, []int{2, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStore(NewMemStore(nil))
+			defer SetStore(nil)
+			for _, user := range users {
+				if err := writeUserData(user); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := mergeUserFiles(path, tt.excludeIncomplete); err != nil {
+				t.Fatalf("mergeUserFiles() error = %v", err)
+			}
+			if order := mergedOrder(t, path); !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("合并顺序 = %v, want %v", order, tt.wantOrder)
+			}
+
+			SetStore(NewMemStore(nil))
+			if err := splitUserFile(path); err != nil {
+				t.Fatalf("splitUserFile() error = %v", err)
+			}
+			for _, want := range users[:3] {
+				got, err := readUserData(want.UserID)
+				if err != nil {
+					t.Fatalf("拆分后读取用户 %d 失败: %v", want.UserID, err)
+				}
+				got.CatchTime = want.CatchTime // 拆分时刷新抓取时间
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("拆分后用户 %d = %+v, want %+v", want.UserID, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 分片索引是追加日志，重复、过期和已删除的记录不应出现在合并结果中
+func TestMergeStaleIndex(t *testing.T) {
+	useTempDataRoot(t)
+	store := fsStore{}
+	SetStore(store)
+	for _, user := range []JsonUserFile{testUser(1, 5), testUser(2, 1), testUser(3, 2), testUser(1, 5)} {
+		if err := store.SaveUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveUser(testUser(2, 6)); err != nil { // project_id 变化后旧记录过期
+		t.Fatal(err)
+	}
+	if err := store.DeleteUser(3); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "user.ndjson")
+	if err := mergeUserFiles(path, false); err != nil {
+		t.Fatalf("mergeUserFiles() error = %v", err)
+	}
+	if order, want := mergedOrder(t, path), []int{1, 2}; !reflect.DeepEqual(order, want) {
+		t.Errorf("合并顺序 = %v, want %v", order, want)
+	}
+}
+
+func mergedOrder(t *testing.T, path string) []int {
+	t.Helper()
+	input, err := OpenCompressed(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	var order []int
+	err = readUserStream(input, func(user JsonUserFile) error {
+		order = append(order, user.UserID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
@@ -1,12 +1,17 @@
 package user
 
 type Subject struct {
-	SubjectID int      `json:"subject_id"`
-	ProjectID int      `json:"project_id"`
-	Tags      []string `json:"tags"`
-	Comment   string   `json:"comment"`
-	Rate      int      `json:"rate"`
-	UpdatedAt string   `json:"updated_at"`
+	SubjectID int          `json:"subject_id"`
+	ProjectID int          `json:"project_id"` // 条目不在动画映射表中时为 -1
+	Tags      []string     `json:"tags"`
+	Comment   string       `json:"comment"`
+	Rate      int          `json:"rate"`
+	UpdatedAt string       `json:"updated_at"`
+	Type      int          `json:"type"`       // 收藏类型：1想看 2看过 3在看 4搁置 5抛弃
+	EpStatus  int          `json:"ep_status"`  // 看到第几话
+	VolStatus int          `json:"vol_status"` // 看到第几卷
+	Private   bool         `json:"private"`
+	Info      *SlimSubject `json:"subject,omitempty"` // 收藏接口附带的条目摘要
 }
 
 type JsonUserFile struct {
@@ -19,6 +24,42 @@ type JsonUserFile struct {
 	OnHold    []Subject `json:"on_hold"`
 	Dropped   []Subject `json:"dropped"`
 	CatchTime string    `json:"catch_time"`
+	// 最近一次完整抓取的时间，增量更新无法发现被删除的收藏，需要定期完整抓取
+	FullSyncTime string `json:"full_sync_time,omitempty"`
+	// 各收藏类型的抓取状态，键为 collectionTypeNames 中的名称
+	FetchStatus map[string]TypeStatus `json:"fetch_status,omitempty"`
+}
+
+// 单个收藏类型的抓取状态
+type TypeStatus struct {
+	Status     string `json:"status"`           // ok / failed / partial
+	Offset     int    `json:"offset,omitempty"` // partial 时出错的分页偏移
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+const (
+	fetchOK      = "ok"
+	fetchFailed  = "failed"
+	fetchPartial = "partial"
+)
+
+// 收藏类型（1-5）对应的名称，与 JsonUserFile 的字段一致
+var collectionTypeNames = [5]string{"wish", "collect", "doing", "on_hold", "dropped"}
+
+// 所有收藏类型都已完整获取；没有状态记录的旧数据视为完整
+func (u *JsonUserFile) isComplete() bool {
+	for _, status := range u.FetchStatus {
+		if status.Status != fetchOK {
+			return false
+		}
+	}
+	return true
+}
+
+// 收藏类型（1-5）对应的列表
+func (u *JsonUserFile) collectionList(collectionType int) *[]Subject {
+	return [5]*[]Subject{&u.Wish, &u.Collect, &u.Doing, &u.OnHold, &u.Dropped}[collectionType-1]
 }
 
 type ApiResponse struct {
@@ -29,11 +70,56 @@ type ApiResponse struct {
 }
 
 type Collection struct {
-	UpdatedAt   string   `json:"updated_at"`
-	Comment     string   `json:"comment"`
-	Tags        []string `json:"tags"`
-	SubjectID   int      `json:"subject_id"`
-	SubjectType int      `json:"subject_type"`
-	Type        int      `json:"type"`
-	Rate        int      `json:"rate"`
+	UpdatedAt   string       `json:"updated_at"`
+	Comment     string       `json:"comment"`
+	Tags        []string     `json:"tags"`
+	SubjectID   int          `json:"subject_id"`
+	SubjectType int          `json:"subject_type"`
+	Type        int          `json:"type"`
+	Rate        int          `json:"rate"`
+	EpStatus    int          `json:"ep_status"`
+	VolStatus   int          `json:"vol_status"`
+	Private     bool         `json:"private"`
+	Subject     *SlimSubject `json:"subject"`
+}
+
+type SlimSubject struct {
+	ID              int     `json:"id"`
+	Type            int     `json:"type"`
+	Name            string  `json:"name"`
+	NameCn          string  `json:"name_cn"`
+	ShortSummary    string  `json:"short_summary"`
+	Date            string  `json:"date"`
+	Eps             int     `json:"eps"`
+	Volumes         int     `json:"volumes"`
+	CollectionTotal int     `json:"collection_total"`
+	Score           float64 `json:"score"`
+	Rank            int     `json:"rank"`
+}
+
+// /v0/users/{username} 返回的用户资料
+type apiUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+	Sign     string `json:"sign"`
+	Avatar   struct {
+		Large string `json:"large"`
+	} `json:"avatar"`
+}
+
+// 本地缓存的用户身份
+type Identity struct {
+	UserID    int     `json:"user_id"`
+	UserName  string  `json:"username"` // 未设置用户名的用户与数字ID相同
+	Nickname  string  `json:"nickname"`
+	Avatar    string  `json:"avatar"`
+	Sign      string  `json:"sign"`
+	Aliases   []Alias `json:"aliases,omitempty"` // 曾用用户名
+	CheckedAt string  `json:"checked_at"`
+}
+
+type Alias struct {
+	UserName string `json:"username"`
+	Until    string `json:"until"` // 发现用户名已更改的时间
 }